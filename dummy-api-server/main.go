@@ -2,13 +2,18 @@ package main
 
 import (
 	"bufio"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/gorilla/mux"
 )
@@ -80,21 +85,36 @@ func (h *handler) getNodeGLBIDMapping(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *handler) postIPRoutingInfoCfg(w http.ResponseWriter, r *http.Request) {
-	type netMaskInfo struct {
-		NetMaskAddress string `json:"netMaskAddress"`
-		NetCode        string `json:"netCode"`
-	}
-	type glbInfo struct {
-		GLBID              string         `json:"glbId"`
-		NetMaskAddressList []*netMaskInfo `json:"netMaskAddressList"`
-	}
+type netMaskInfo struct {
+	NetMaskAddress string `json:"netMaskAddress"`
+	NetCode        string `json:"netCode"`
+}
 
-	type serviceCodeInfo struct {
-		ServiceCode      string     `json:"serviceCode"`
-		GLBIDNetMaskList []*glbInfo `json:"glbIdNetMaskList"`
+type glbInfo struct {
+	GLBID              string         `json:"glbId"`
+	NetMaskAddressList []*netMaskInfo `json:"netMaskAddressList"`
+}
+
+type serviceCodeInfo struct {
+	ServiceCode      string     `json:"serviceCode"`
+	GLBIDNetMaskList []*glbInfo `json:"glbIdNetMaskList"`
+}
+
+func writeIPMSJSON(infos []serviceCodeInfo) {
+	f, err := os.Create("ipms.json")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(infos)
+	if err != nil {
+		log.Fatal(err)
 	}
+}
 
+func (h *handler) postIPRoutingInfoCfg(w http.ResponseWriter, r *http.Request) {
 	var infos []serviceCodeInfo
 	dec := json.NewDecoder(r.Body)
 	err := dec.Decode(&infos)
@@ -119,16 +139,125 @@ func (h *handler) postIPRoutingInfoCfg(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusCreated)
 
-	f, err := os.Create("ipms.json")
+	writeIPMSJSON(infos)
+}
+
+// postIPRoutingInfoCfgDelta : applies added and removed netMasks to ipms.json
+func (h *handler) postIPRoutingInfoCfgDelta(w http.ResponseWriter, r *http.Request) {
+	type glbDelta struct {
+		GLBID   string         `json:"glbId"`
+		Added   []*netMaskInfo `json:"addedNetMaskAddressList"`
+		Removed []*netMaskInfo `json:"removedNetMaskAddressList"`
+	}
+	type serviceCodeDelta struct {
+		ServiceCode    string      `json:"serviceCode"`
+		GLBIDDeltaList []*glbDelta `json:"glbIdDeltaList"`
+	}
+
+	var deltas []serviceCodeDelta
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(&deltas)
 	if err != nil {
-		log.Fatal(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintln(w, err)
+		return
 	}
-	enc := json.NewEncoder(f)
-	enc.SetIndent("", "  ")
-	err = enc.Encode(infos)
+
+	var infos []serviceCodeInfo
+	b, err := ioutil.ReadFile("ipms.json")
 	if err != nil {
-		log.Fatal(err)
+		w.WriteHeader(http.StatusConflict)
+		fmt.Fprintln(w, "no full import to apply delta,", err)
+		return
 	}
+	err = json.Unmarshal(b, &infos)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintln(w, err)
+		return
+	}
+
+	// findGLB : nil when glbId of serviceCode not exist and create is false
+	findGLB := func(serviceCode, glbID string, create bool) *glbInfo {
+		for i := range infos {
+			if infos[i].ServiceCode != serviceCode {
+				continue
+			}
+			for _, g := range infos[i].GLBIDNetMaskList {
+				if g.GLBID == glbID {
+					return g
+				}
+			}
+			if !create {
+				return nil
+			}
+			g := &glbInfo{GLBID: glbID}
+			infos[i].GLBIDNetMaskList = append(infos[i].GLBIDNetMaskList, g)
+			return g
+		}
+		if !create {
+			return nil
+		}
+		g := &glbInfo{GLBID: glbID}
+		infos = append(infos, serviceCodeInfo{serviceCode, []*glbInfo{g}})
+		return g
+	}
+
+	added, removed := 0, 0
+	for _, s := range deltas {
+		for _, d := range s.GLBIDDeltaList {
+			if g := findGLB(s.ServiceCode, d.GLBID, false); g != nil {
+				for _, n := range d.Removed {
+					for i, m := range g.NetMaskAddressList {
+						if *m == *n {
+							g.NetMaskAddressList = append(g.NetMaskAddressList[:i], g.NetMaskAddressList[i+1:]...)
+							log.Printf("- [%s, %s, %s, %s]", s.ServiceCode, d.GLBID, n.NetCode, n.NetMaskAddress)
+							removed++
+							break
+						}
+					}
+				}
+			}
+			if len(d.Added) == 0 {
+				continue
+			}
+			g := findGLB(s.ServiceCode, d.GLBID, true)
+		add:
+			for _, n := range d.Added {
+				for _, m := range g.NetMaskAddressList {
+					if *m == *n {
+						log.Printf("already exist [%s, %s, %s, %s]", s.ServiceCode, d.GLBID, n.NetCode, n.NetMaskAddress)
+						continue add
+					}
+				}
+				g.NetMaskAddressList = append(g.NetMaskAddressList, n)
+				log.Printf("+ [%s, %s, %s, %s]", s.ServiceCode, d.GLBID, n.NetCode, n.NetMaskAddress)
+				added++
+			}
+		}
+	}
+
+	// drop the glbIds and the serviceCodes that have no netMask left
+	kept := []serviceCodeInfo{}
+	for _, info := range infos {
+		var glbs []*glbInfo
+		for _, g := range info.GLBIDNetMaskList {
+			if len(g.NetMaskAddressList) > 0 {
+				glbs = append(glbs, g)
+			}
+		}
+		if len(glbs) == 0 {
+			continue
+		}
+		info.GLBIDNetMaskList = glbs
+		kept = append(kept, info)
+	}
+	infos = kept
+	log.Printf("total added %d, removed %d lines", added, removed)
+
+	w.WriteHeader(http.StatusCreated)
+
+	writeIPMSJSON(infos)
 }
 
 func (h *handler) postReportCollector(w http.ResponseWriter, r *http.Request) {
@@ -168,10 +297,63 @@ func (h *handler) postReportCollector(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// failFirst : answers 503 to the first n requests, to test the retries of the importers
+func failFirst(n int, next http.Handler) http.Handler {
+	var mu sync.Mutex
+	count := 0
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s, Idempotency-Key[%s]", r.Method, r.URL, r.Header.Get("Idempotency-Key"))
+		mu.Lock()
+		count++
+		fail := count <= n
+		mu.Unlock()
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, "failed by -fail-requests")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// serverTLSConfig : https config of the certificate, nil for http
+// -client-ca-file requires https, it is an error without -cert-file and -key-file
+func serverTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("-cert-file and -key-file must be set together")
+	}
+	if certFile == "" {
+		if clientCAFile != "" {
+			return nil, errors.New("-client-ca-file requires -cert-file and -key-file")
+		}
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	tc := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if clientCAFile != "" {
+		b, err := ioutil.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificate in %s", clientCAFile)
+		}
+		tc.ClientCAs = pool
+		tc.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tc, nil
+}
+
 func main() {
 	addr := flag.String("addr", ":8780", "listen address")
 	certFile := flag.String("cert-file", "", "https certificate file")
 	keyFile := flag.String("key-file", "", "https private key file")
+	clientCAFile := flag.String("client-ca-file", "", "require https client certificates signed by the CAs of this file")
+	failRequests := flag.Int("fail-requests", 0, "answer 503 Service Unavailable to the first n requests")
 	flag.Parse()
 
 	h := &handler{}
@@ -179,13 +361,21 @@ func main() {
 	api.HandleFunc("/mapping/officeNode", h.getOfficeNodeMapping).Methods("GET")
 	api.HandleFunc("/mapping/nodeGLBId", h.getNodeGLBIDMapping).Methods("GET")
 	api.HandleFunc("/import/ipms", h.postIPRoutingInfoCfg).Methods("POST")
+	api.HandleFunc("/import/ipms/delta", h.postIPRoutingInfoCfgDelta).Methods("POST")
 	api.HandleFunc("/import/reportCollector", h.postReportCollector).Methods("POST")
 
-	var err error
-	if *certFile != "" && *keyFile != "" {
-		err = http.ListenAndServeTLS(*addr, *certFile, *keyFile, api)
+	root := failFirst(*failRequests, api)
+
+	tc, err := serverTLSConfig(*certFile, *keyFile, *clientCAFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	srv := &http.Server{Addr: *addr, Handler: root, TLSConfig: tc}
+	if tc != nil {
+		// the certificate is in TLSConfig
+		err = srv.ListenAndServeTLS("", "")
 	} else {
-		err = http.ListenAndServe(*addr, api)
+		err = srv.ListenAndServe()
 	}
 
 	if err != nil {
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeCert : certificate and key of name in dir as name.pem and name.key, signed by parent,
+// or self-signed CA when parent is nil
+func writeCert(t *testing.T, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid, tmpl.KeyUsage = true, true, x509.KeyUsageCertSign
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kb, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name+".pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kb}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestServerTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := writeCert(t, dir, "ca", nil, nil)
+	writeCert(t, dir, "server", ca, caKey)
+	if err := ioutil.WriteFile(filepath.Join(dir, "empty.pem"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	path := func(name string) string {
+		if name == "" {
+			return ""
+		}
+		return filepath.Join(dir, name)
+	}
+
+	tests := []struct {
+		name                string
+		cert, key, clientCA string
+		wantTLS             bool
+		wantClientAuth      tls.ClientAuthType
+		wantErr             string // empty when the flags are valid
+	}{
+		{name: "http"},
+		{name: "https", cert: "server.pem", key: "server.key", wantTLS: true, wantClientAuth: tls.NoClientCert},
+		{name: "https with client ca", cert: "server.pem", key: "server.key", clientCA: "ca.pem", wantTLS: true, wantClientAuth: tls.RequireAndVerifyClientCert},
+		{name: "client ca without https", clientCA: "ca.pem", wantErr: "-client-ca-file requires -cert-file and -key-file"},
+		{name: "cert without key", cert: "server.pem", clientCA: "ca.pem", wantErr: "must be set together"},
+		{name: "key without cert", key: "server.key", wantErr: "must be set together"},
+		{name: "client ca of no certificate", cert: "server.pem", key: "server.key", clientCA: "empty.pem", wantErr: "no certificate in"},
+		{name: "client ca not exist", cert: "server.pem", key: "server.key", clientCA: "none.pem", wantErr: "none.pem"},
+		{name: "key of other cert", cert: "server.pem", key: "ca.key", wantErr: "private key does not match"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc, err := serverTLSConfig(path(tt.cert), path(tt.key), path(tt.clientCA))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (tc != nil) != tt.wantTLS {
+				t.Fatalf("tls config %v, want https %v", tc, tt.wantTLS)
+			}
+			if tc != nil && (len(tc.Certificates) != 1 || tc.ClientAuth != tt.wantClientAuth || (tt.clientCA != "") != (tc.ClientCAs != nil)) {
+				t.Errorf("certificates[%d], client auth[%v], want 1, %v", len(tc.Certificates), tc.ClientAuth, tt.wantClientAuth)
+			}
+		})
+	}
+}
+
+func TestServerTLSConfigClientCert(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := writeCert(t, dir, "ca", nil, nil)
+	writeCert(t, dir, "server", ca, caKey)
+	writeCert(t, dir, "client", ca, caKey)
+	other, otherKey := writeCert(t, dir, "other-ca", nil, nil)
+	writeCert(t, dir, "other", other, otherKey)
+
+	tc, err := serverTLSConfig(filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key"), filepath.Join(dir, "ca.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = tc
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	get := func(client string) error {
+		tlsCfg := &tls.Config{RootCAs: roots}
+		if client != "" {
+			cert, err := tls.LoadX509KeyPair(filepath.Join(dir, client+".pem"), filepath.Join(dir, client+".key"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tlsCfg.Certificates = []tls.Certificate{cert}
+		}
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsCfg}}
+		resp, err := c.Get(srv.URL)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	if err := get("client"); err != nil {
+		t.Errorf("client certificate of the ca, %v", err)
+	}
+	if err := get(""); err == nil {
+		t.Errorf("no client certificate, want an error")
+	}
+	if err := get("other"); err == nil {
+		t.Errorf("client certificate of other ca, want an error")
+	}
+}
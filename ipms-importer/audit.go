@@ -0,0 +1,22 @@
+package main
+
+import (
+	"io"
+
+	"github.com/castisdev/cilog"
+	"github.com/castisdev/ipms-importer/ipms"
+)
+
+// runAudit : writes the audit report of the mapping tables and the office codes of recs and stats
+func runAudit(w io.Writer, format string, tables *ipms.MappingTables, status *ipms.MappingStatus, recs []*ipms.IpmsRecord, stats *ipms.InputStats) error {
+	r := ipms.AuditMapping(tables, status.MultiGLB, ipms.InputOfficeLines(recs, stats))
+	if format == ipms.AuditFormatJSON {
+		if err := ipms.WriteJSON(w, r, true); err != nil {
+			return err
+		}
+	} else {
+		r.Print(w)
+	}
+	cilog.Infof("success to audit, problems[%d]", r.Problems())
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/castisdev/cilog"
+	"github.com/castisdev/ipms-importer/ipms"
+)
+
+// runDaemon : imports every complete file of watch-directory, one at a time, until SIGINT or SIGTERM
+// a signal during an import stops the daemon after the import is finished
+func runDaemon(cfg *ipms.YmlConfig, opt *options) error {
+	wc, err := cfg.WatchConfig()
+	if err != nil {
+		return err
+	}
+	w, err := ipms.NewWatcher(wc)
+	if err != nil {
+		return err
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	stop := make(chan struct{})
+	go func() {
+		s := <-sig
+		cilog.Infof("received %v, stop watching after the current import", s)
+		close(stop)
+	}()
+
+	w.Run(stop, func(filename string) error {
+		cilog.Infof("start to import %s", filename)
+		err := runImport(cfg, opt, []string{filename})
+		if err != nil {
+			cilog.Errorf("failed to import %s, %v", filename, err)
+		}
+		return err
+	})
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/castisdev/ipms-importer/ipms"
+)
+
+type diffCount struct {
+	added         int
+	removed       int
+	reassignedIn  int
+	reassignedOut int
+}
+
+// printDiff : prints every changed netMask and the count of changes per serviceCode and glbId
+func printDiff(w io.Writer, entries []*ipms.DiffEntry) {
+	fmt.Fprintln(w, "KIND\tSERVICE_CODE\tGLB_ID\tNET_CODE\tNET_MASK\tPREV_GLB_ID\tPREV_NET_CODE")
+
+	type key struct {
+		serviceCode string
+		glbID       string
+	}
+	var keys []key
+	counts := map[key]*diffCount{}
+	count := func(serviceCode, glbID string) *diffCount {
+		k := key{serviceCode, glbID}
+		if _, ok := counts[k]; !ok {
+			keys = append(keys, k)
+			counts[k] = &diffCount{}
+		}
+		return counts[k]
+	}
+
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.Kind, e.ServiceCode, e.GLBID, e.NetCode, e.CIDR, e.PrevGLBID, e.PrevNetCode)
+		switch e.Kind {
+		case ipms.DiffAdded:
+			count(e.ServiceCode, e.GLBID).added++
+		case ipms.DiffRemoved:
+			count(e.ServiceCode, e.PrevGLBID).removed++
+		case ipms.DiffReassigned:
+			count(e.ServiceCode, e.GLBID).reassignedIn++
+			count(e.ServiceCode, e.PrevGLBID).reassignedOut++
+		}
+	}
+
+	fmt.Fprintln(w)
+	for _, k := range keys {
+		c := counts[k]
+		fmt.Fprintf(w, "serviceCode[%s], glbId[%s], added[%d], removed[%d], reassigned in[%d], reassigned out[%d]\n", k.serviceCode, k.glbID, c.added, c.removed, c.reassignedIn, c.reassignedOut)
+	}
+	fmt.Fprintf(w, "total changes[%d]\n", len(entries))
+}
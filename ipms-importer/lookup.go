@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/castisdev/ipms-importer/ipms"
+)
+
+// lookupIPs : target is an IP address or a file of IP addresses, one per line
+func lookupIPs(target string) ([]string, error) {
+	if net.ParseIP(target) != nil {
+		return []string{target}, nil
+	}
+
+	f, err := os.Open(target)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var ips []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ips = append(ips, line)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return ips, nil
+}
+
+// runLookup : prints the merged netMask, glbId and netCode that each IP address is routed to,
+// officeCode comes from the ipms record of the same glbId before merging
+func runLookup(w io.Writer, target, serviceCode string, recs []*ipms.IpmsRecord) error {
+	ips, err := lookupIPs(target)
+	if err != nil {
+		return err
+	}
+
+	parsed := ipms.NewPrefixIndex(recs)
+	merged, err := ipms.AggregateIPMSRecords(append([]*ipms.IpmsRecord(nil), recs...))
+	if err != nil {
+		return err
+	}
+	index := ipms.NewPrefixIndex(merged)
+
+	fmt.Fprintln(w, "IP\tSERVICE_CODE\tGLB_ID\tNET_CODE\tNET_MASK\tOFFICE_CODE")
+	for _, s := range ips {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			fmt.Fprintf(w, "%s\tinvalid ip\n", s)
+			continue
+		}
+		found := index.Lookup(ip, serviceCode)
+		if len(found) == 0 {
+			fmt.Fprintf(w, "%s\tnot found\n", s)
+			continue
+		}
+		origins := parsed.Lookup(ip, serviceCode)
+		for _, rec := range found {
+			officeCode := ""
+			for _, o := range origins {
+				if o.ServiceCode == rec.ServiceCode && o.GLBID == rec.GLBID && o.NetCode == rec.NetCode {
+					officeCode = o.OfficeCode
+					break
+				}
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", s, rec.ServiceCode, rec.GLBID, rec.NetCode, rec.CIDR, officeCode)
+		}
+	}
+	return nil
+}
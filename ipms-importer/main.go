@@ -1,13 +1,10 @@
 package main
 
 import (
-	"bufio"
 	"flag"
 	"fmt"
-	"net"
 	"os"
 	"path"
-	"strings"
 
 	"github.com/castisdev/cilog"
 	"github.com/castisdev/ipms-importer/ipms"
@@ -17,19 +14,36 @@ import (
 const (
 	component   = "ipms-importer"
 	ymlFilename = "ipms-importer.yml"
-	ver         = "1.0.2"
+	ver         = "1.1.0"
 	preRelVer   = "-rc.0"
+
+	defaultInputFormat = "ipms-v2"
 )
 
 func main() {
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [options]... INPUT_FILE\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s [options]... INPUT_FILE...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s [options]... -daemon\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s [options]... -history | -rollback ID\n", os.Args[0])
 		flag.PrintDefaults()
 	}
 
 	ymlConfigFilePath := flag.String("config-file", "", "config file path")
+	format := flag.String("input-format", "", fmt.Sprintf("input format %v, overrides input-format of config (default %s)", ipms.SourceFormats(), defaultInputFormat))
 	printSimpleVer := flag.Bool("v", false, "print version")
 	printVer := flag.Bool("version", false, "print version includes pre-release version")
+	dryRun := flag.Bool("dry-run", false, "write the post body and summary instead of posting it")
+	dryRunOutput := flag.String("dry-run-output", "-", "file to write the post body of -dry-run, - means stdout")
+	pretty := flag.Bool("pretty", false, "indent the post body of -dry-run")
+	force := flag.Bool("force", false, "import even if the safety thresholds of config are exceeded")
+	lookup := flag.String("lookup", "", "print the glbId and netCode of an IP address, or of every IP address in a file, instead of import")
+	serviceCode := flag.String("service-code", "", "service code for -lookup, every service code if empty")
+	listHistory := flag.Bool("history", false, "print the successful imports kept in history-directory of config")
+	rollback := flag.String("rollback", "", "post the import of this history ID again to import-ipms-api, instead of INPUT_FILE")
+	daemon := flag.Bool("daemon", false, "watch watch-directory of config and import every complete file, instead of INPUT_FILE")
+	diffPrev := flag.String("diff", "", "print the changes from this previous input (file, directory or glob pattern) to INPUT_FILE..., instead of import")
+	audit := flag.Bool("audit", false, "print the inconsistencies between the mappings and the office codes of INPUT_FILE..., instead of import")
+	auditFormat := flag.String("audit-format", ipms.AuditFormatText, fmt.Sprintf("report format of -audit, %s or %s", ipms.AuditFormatText, ipms.AuditFormatJSON))
 	flag.Parse()
 
 	if *printSimpleVer {
@@ -42,17 +56,43 @@ func main() {
 		os.Exit(0)
 	}
 
-	if flag.NArg() < 1 {
+	noInput := *daemon || *listHistory || *rollback != ""
+	if *listHistory || *rollback != "" {
+		if flag.NArg() > 0 || *daemon || (*listHistory && *rollback != "") {
+			fmt.Fprintf(os.Stderr, "-history and -rollback can not be used with INPUT_FILE, -daemon or each other\n\n")
+			flag.Usage()
+			os.Exit(1)
+		}
+	} else if *daemon {
+		// -dry-run would move the watched files to processed/ without importing them
+		if flag.NArg() > 0 || *lookup != "" || *diffPrev != "" || *audit || *dryRun {
+			fmt.Fprintf(os.Stderr, "-daemon can not be used with INPUT_FILE, -lookup, -diff, -audit or -dry-run\n\n")
+			flag.Usage()
+			os.Exit(1)
+		}
+	} else if flag.NArg() < 1 {
 		fmt.Fprintf(os.Stderr, "there is no INPUT_FILE\n\n")
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	if _, err := os.Stat(flag.Arg(0)); os.IsNotExist(err) {
-		fmt.Fprintln(os.Stderr, err)
+	if *auditFormat != ipms.AuditFormatText && *auditFormat != ipms.AuditFormatJSON {
+		fmt.Fprintf(os.Stderr, "invalid -audit-format, %s\n\n", *auditFormat)
+		flag.Usage()
 		os.Exit(1)
 	}
 
+	// files, directories or glob patterns
+	var inputs []string
+	if !noInput {
+		var err error
+		inputs, err = ipms.ExpandInputs(flag.Args())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
 	if len(*ymlConfigFilePath) == 0 {
 		dir, err := osext.ExecutableFolder()
 		if err != nil {
@@ -76,154 +116,94 @@ func main() {
 
 	cilog.Infof("program started")
 
-	mapping, err := ipms.GetOfficeGLBIDMapping(cfg)
-	if err != nil {
-		str := fmt.Sprintf("failed to get mapping info, %v", err)
-		cilog.Errorf(str)
-		fmt.Fprintln(os.Stderr, str)
-		os.Exit(1)
-	}
-
-	ipmsSet, err := getIPMSRecords2(flag.Arg(0), mapping)
-	if err != nil {
-		str := fmt.Sprintf("failed to get ipms records, %v", err)
-		cilog.Errorf(str)
-		fmt.Fprintln(os.Stderr, str)
-		os.Exit(1)
-	}
-
-	resultSet, err := ipms.MergeIPMSRecords(ipmsSet)
-	if err != nil {
-		str := fmt.Sprintf("failed to merge ipms records, %v", err)
-		cilog.Errorf(str)
-		fmt.Fprintln(os.Stderr, str)
-		os.Exit(1)
+	if *format == "" {
+		*format = cfg.InputFormat
+	}
+	if *format == "" {
+		*format = defaultInputFormat
+	}
+
+	opt := &options{
+		ImportOptions: ipms.ImportOptions{
+			Format:       *format,
+			DryRun:       *dryRun,
+			DryRunOutput: *dryRunOutput,
+			Pretty:       *pretty,
+			Force:        *force,
+		},
+		lookup:      *lookup,
+		serviceCode: *serviceCode,
+		diffPrev:    *diffPrev,
+		audit:       *audit,
+		auditFormat: *auditFormat,
+	}
+
+	switch {
+	case *listHistory:
+		err = ipms.PrintIPMSHistory(os.Stdout, cfg)
+	case *rollback != "":
+		err = ipms.RunRollback(cfg, *rollback)
+	case *daemon:
+		err = runDaemon(cfg, opt)
+	default:
+		err = runImport(cfg, opt, inputs)
 	}
-
-	err = ipms.PostIPMSRecords(cfg, resultSet)
 	if err != nil {
-		str := fmt.Sprintf("failed to post ipms records, %v", err)
+		str := err.Error()
 		cilog.Errorf(str)
 		fmt.Fprintln(os.Stderr, str)
 		os.Exit(1)
 	}
-
-	str := fmt.Sprintf("success to import, %s", flag.Arg(0))
-	cilog.Infof(str)
-	fmt.Println(str)
 	cilog.Infof("program ended")
 }
 
-func getIPMSRecords(filename string, mapping map[string][]ipms.OfficeGLBIDMapping) ([]*ipms.IpmsRecord, error) {
-	var recs []*ipms.IpmsRecord
+// options : command line options of an import and of the runs instead of it
+type options struct {
+	ipms.ImportOptions
+	lookup      string
+	serviceCode string
+	diffPrev    string
+	audit       bool
+	auditFormat string
+}
 
-	f, err := os.Open(filename)
+// runImport : reads inputs, and then imports, or runs -audit, -diff, -lookup or -dry-run instead
+func runImport(cfg *ipms.YmlConfig, opt *options, inputs []string) error {
+	run, err := ipms.LoadImport(cfg, opt.Format, inputs)
 	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-
-	s := bufio.NewScanner(f)
-	lineCnt := 0
-	invalidLineCnt := 0
-	failedOfficeCodes := map[string]int{}
-	for s.Scan() {
-		line := s.Text()
-		lineCnt++
-		ret := strings.Split(line, "|")
-		if len(ret) < 8 {
-			cilog.Warningf("invalid line[%d], %s", lineCnt, line)
-			invalidLineCnt++
-			continue
-		}
-		officeCode := ret[5]
-		if glbs, ok := mapping[officeCode]; ok {
-			for _, glb := range glbs {
-				netCode := ret[1]
-				ipStart := ret[0]
-				prefix := ret[7]
-				rec, err := ipms.NewRecord(glb.ServiceCode, glb.GLBID, netCode, officeCode, ipStart, prefix)
-				if err != nil {
-					return nil, err
-				}
-				recs = append(recs, rec)
-			}
-		} else {
-			failedOfficeCodes[officeCode] = lineCnt
-			invalidLineCnt++
-		}
+		return err
 	}
 
-	if err := s.Err(); err != nil {
-		return nil, err
+	if opt.audit {
+		if err := runAudit(os.Stdout, opt.auditFormat, run.Tables, run.MappingStatus, run.Records, run.InputStats); err != nil {
+			return fmt.Errorf("failed to audit, %v", err)
+		}
+		return nil
 	}
 
-	for k, v := range failedOfficeCodes {
-		cilog.Warningf("invalid office code, %s, line[%d]", k, v)
+	if err := run.ResolveRecords(cfg); err != nil {
+		return err
 	}
-	cilog.Infof("success to parse file, lines[%d], invalid lines[%d]", len(recs), invalidLineCnt)
-
-	return recs, nil
-}
-
-func getIPMSRecords2(filename string, mapping map[string][]ipms.OfficeGLBIDMapping) ([]*ipms.IpmsRecord, error) {
-	var recs []*ipms.IpmsRecord
 
-	f, err := os.Open(filename)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-
-	s := bufio.NewScanner(f)
-	lineCnt := 0
-	invalidLineCnt := 0
-	failedOfficeCodes := map[string]int{}
-	for s.Scan() {
-		line := s.Text()
-		lineCnt++
-		ret := strings.Split(line, "|")
-		if len(ret) != 8 {
-			cilog.Warningf("invalid line[%d], %s", lineCnt, line)
-			invalidLineCnt++
-			continue
+	if opt.diffPrev != "" {
+		prevInputs, err := ipms.ExpandInputs([]string{opt.diffPrev})
+		if err != nil {
+			return fmt.Errorf("failed to get previous ipms records, %v", err)
 		}
-		officeCode := ret[3]
-		if glbs, ok := mapping[officeCode]; ok {
-			for _, glb := range glbs {
-				netCode := ret[6]
-
-				ips := net.ParseIP(ret[0])
-				ipe := net.ParseIP(ret[1])
-				if ips == nil || ipe == nil {
-					cilog.Warningf("invalid row[%d], %s, %s", lineCnt, ret[0], ret[1])
-					invalidLineCnt++
-					continue
-				}
-
-				cidrs := ipms.Range2CIDRs(ips, ipe)
-				for _, cidr := range cidrs {
-					rec, err := ipms.NewRecordFromCIDR(glb.ServiceCode, glb.GLBID, netCode, officeCode, cidr)
-					if err != nil {
-						return nil, err
-					}
-					recs = append(recs, rec)
-				}
-			}
-		} else {
-			failedOfficeCodes[officeCode] = lineCnt
-			invalidLineCnt++
+		prevSet, err := run.LoadResolvedRecords(cfg, opt.Format, prevInputs)
+		if err != nil {
+			return fmt.Errorf("failed to get previous ipms records, %v", err)
 		}
+		printDiff(os.Stdout, ipms.DiffIPMSRecords(prevSet, run.Records))
+		return nil
 	}
 
-	if err := s.Err(); err != nil {
-		return nil, err
-	}
-
-	for k, v := range failedOfficeCodes {
-		cilog.Warningf("invalid office code, %s, line[%d]", k, v)
+	if opt.lookup != "" {
+		if err := runLookup(os.Stdout, opt.lookup, opt.serviceCode, run.Records); err != nil {
+			return fmt.Errorf("failed to lookup, %v", err)
+		}
+		return nil
 	}
-	cilog.Infof("success to parse file, lines[%d], invalid lines[%d]", len(recs), invalidLineCnt)
 
-	return recs, nil
+	return ipms.RunImport(cfg, &opt.ImportOptions, run)
 }
@@ -1,11 +1,9 @@
 package main
 
 import (
-	"bufio"
 	"encoding/csv"
 	"flag"
 	"fmt"
-	"net"
 	"os"
 	"path/filepath"
 	"strings"
@@ -16,19 +14,26 @@ import (
 
 const (
 	component = "ipms-to-report-collector"
-	ver       = "1.0.0"
+	ver       = "1.1.0"
 	preRelVer = "-rc.0"
 )
 
 func main() {
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [options]... INPUT_FILE\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s [options]... INPUT_FILE...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s [options]... -history | -rollback ID\n", os.Args[0])
 		flag.PrintDefaults()
 	}
 
 	logDirPath := flag.String("log-dir", "./log", "log dir path")
 	outputDirPath := flag.String("output-dir", "./output", "output dir path")
 	api := flag.String("api-url", "http://localhost:8780/import/reportCollector", "api url")
+	ymlConfigFilePath := flag.String("config-file", "", "optional config file path, only input-*, filters, reject-* and http settings are used")
+	format := flag.String("input-format", "", fmt.Sprintf("input format %v, overrides input-format of config (default ipms-v2)", ipms.SourceFormats()))
+	historyDirPath := flag.String("history-dir", "", "dir to keep the successful posts, no history if empty")
+	historyKeep := flag.Int("history-keep", 0, "number of posts to keep in -history-dir, 0 keeps every post")
+	listHistory := flag.Bool("history", false, "print the posts kept in -history-dir")
+	rollback := flag.String("rollback", "", "post the records of this history ID again to -api-url, instead of INPUT_FILE")
 	printSimpleVer := flag.Bool("v", false, "print version")
 	printVer := flag.Bool("version", false, "print version includes pre-release version")
 	flag.Parse()
@@ -43,22 +48,65 @@ func main() {
 		os.Exit(0)
 	}
 
+	var cfg *ipms.YmlConfig
+	if *ymlConfigFilePath != "" {
+		var err error
+		cfg, err = ipms.NewInputYmlConfig(*ymlConfigFilePath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if *format == "" {
+			*format = cfg.InputFormat
+		}
+	}
+	// the http section of the config, or the defaults
+	client, err := cfg.Client()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *listHistory || *rollback != "" {
+		if flag.NArg() > 0 || *historyDirPath == "" || (*listHistory && *rollback != "") {
+			fmt.Fprintf(os.Stderr, "-history and -rollback need -history-dir, and can not be used with INPUT_FILE or each other\n\n")
+			flag.Usage()
+			os.Exit(1)
+		}
+		cilog.Set(cilog.NewLogWriter(*logDirPath, component, 10*1024*1024), component, ver, cilog.DEBUG)
+		cilog.Infof("program started")
+		if err := runHistory(client, *historyDirPath, *historyKeep, *listHistory, *rollback, *api); err != nil {
+			str := err.Error()
+			cilog.Errorf(str)
+			fmt.Fprintln(os.Stderr, str)
+			os.Exit(1)
+		}
+		cilog.Infof("program ended")
+		return
+	}
+
 	if flag.NArg() < 1 {
 		fmt.Fprintf(os.Stderr, "there is no INPUT_FILE\n\n")
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	if _, err := os.Stat(flag.Arg(0)); os.IsNotExist(err) {
+	// files, directories or glob patterns
+	inputs, err := ipms.ExpandInputs(flag.Args())
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 
+	if *format == "" {
+		*format = "ipms-v2"
+	}
+
 	cilog.Set(cilog.NewLogWriter(*logDirPath, component, 10*1024*1024), component, ver, cilog.DEBUG)
 
 	cilog.Infof("program started")
 
-	ipmsSet, err := getIPMSRecords2(flag.Arg(0))
+	ipmsSet, inputStats, err := ipms.LoadReportCollectorRecordsFiles(*format, inputs, cfg)
 	if err != nil {
 		str := fmt.Sprintf("failed to get ipms records, %v", err)
 		cilog.Errorf(str)
@@ -66,9 +114,24 @@ func main() {
 		os.Exit(1)
 	}
 
-	resultSet := ipms.MergeIPMSRecords2(ipmsSet)
+	err = ipms.WriteRejectFile(cfg, inputStats)
+	if err != nil {
+		str := fmt.Sprintf("failed to write reject file, %v", err)
+		cilog.Errorf(str)
+		fmt.Fprintln(os.Stderr, str)
+		os.Exit(1)
+	}
 
-	_, fn := filepath.Split(flag.Arg(0))
+	resultSet, err := ipms.MergeReportCollectorRecords(ipmsSet)
+	if err != nil {
+		str := fmt.Sprintf("failed to merge ipms records, %v", err)
+		cilog.Errorf(str)
+		fmt.Fprintln(os.Stderr, str)
+		os.Exit(1)
+	}
+
+	// named after the first input file
+	_, fn := filepath.Split(inputs[0])
 	csvFilepath := filepath.Join(*outputDirPath, fn)
 
 	err = os.MkdirAll(*outputDirPath, 0777)
@@ -103,7 +166,7 @@ func main() {
 	}
 	w.Flush()
 
-	err = ipms.PostReportCollectorRecords(*api, resultSet)
+	err = ipms.PostReportCollectorRecordsBy(client, *api, resultSet)
 	if err != nil {
 		str := fmt.Sprintf("failed to post ipms records, %v", err)
 		cilog.Errorf(str)
@@ -111,73 +174,43 @@ func main() {
 		os.Exit(1)
 	}
 
-	str := fmt.Sprintf("success to import, %s", flag.Arg(0))
+	// the import is done, a history that could not be saved does not fail it
+	err = ipms.SaveReportCollectorHistory(*historyDirPath, *historyKeep, *api, inputs, resultSet)
+	if err != nil {
+		str := fmt.Sprintf("WARNING, posted, but failed to save history, %v", err)
+		cilog.Warningf(str)
+		fmt.Fprintln(os.Stderr, str)
+	}
+
+	str := fmt.Sprintf("success to import, %s", strings.Join(inputs, ", "))
 	cilog.Infof(str)
 	fmt.Println(str)
 	cilog.Infof("program ended")
 }
 
-type checkItem struct {
-	beallorg   string
-	officeName string
-	cidr       string
-}
-
-func getIPMSRecords2(filename string) ([]*ipms.IpmsRecord, error) {
-	var recs []*ipms.IpmsRecord
-
-	f, err := os.Open(filename)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-
-	s := bufio.NewScanner(f)
-	lineCnt := 0
-	invalidLineCnt := 0
-	checker := make(map[checkItem]struct{})
-	for s.Scan() {
-		line := s.Text()
-		lineCnt++
-		ret := strings.Split(line, "|")
-		if len(ret) != 8 {
-			cilog.Warningf("invalid line[%d], %s", lineCnt, line)
-			invalidLineCnt++
-			continue
-		}
-		officeName := ret[4]
-		beallorg := ret[2]
-
-		ips := net.ParseIP(ret[0])
-		ipe := net.ParseIP(ret[1])
-		if ips == nil || ipe == nil {
-			cilog.Warningf("invalid row[%d], %s, %s", lineCnt, ret[0], ret[1])
-			invalidLineCnt++
-			continue
-		}
-
-		cidrs := ipms.Range2CIDRs(ips, ipe)
-		for _, cidr := range cidrs {
-			rec, err := ipms.NewRecordFromCIDR(beallorg, officeName, "", officeName, cidr)
-			if err != nil {
-				return nil, err
-			}
-			ci := checkItem{beallorg, officeName, rec.CIDR}
-			if _, ok := checker[ci]; ok {
-				cilog.Warningf("duplicate record, line[%d], %s", lineCnt, line)
-				invalidLineCnt++
-				continue
-			}
-			checker[ci] = struct{}{}
-			recs = append(recs, rec)
+// runHistory : prints the history, or posts the records of history rollback again
+func runHistory(client *ipms.Client, dir string, keep int, list bool, rollback, api string) error {
+	if list {
+		entries, err := ipms.ListHistory(dir)
+		if err != nil {
+			return fmt.Errorf("failed to list history, %v", err)
 		}
+		ipms.PrintHistory(os.Stdout, entries)
+		return nil
 	}
-
-	if err := s.Err(); err != nil {
-		return nil, err
+	e, err := ipms.RollbackReportCollector(client, dir, rollback, api)
+	if err != nil {
+		return fmt.Errorf("failed to rollback to history[%s], %v", rollback, err)
 	}
-
-	cilog.Infof("success to parse file, lines[%d], invalid lines[%d]", len(recs), invalidLineCnt)
-
-	return recs, nil
+	// the rollback is done, a history that could not be saved does not fail it
+	if err := ipms.SaveHistory(dir, e, keep); err != nil {
+		str := fmt.Sprintf("WARNING, posted, but failed to save history, %v", err)
+		cilog.Warningf(str)
+		fmt.Fprintln(os.Stderr, str)
+		e.ID = ""
+	}
+	str := fmt.Sprintf("success to rollback to history[%s], records[%d], new history[%s]", rollback, len(e.ReportCollectorRecords), e.ID)
+	cilog.Infof(str)
+	fmt.Println(str)
+	return nil
 }
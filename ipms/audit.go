@@ -0,0 +1,285 @@
+package ipms
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// audit report formats
+const (
+	AuditFormatText = "text"
+	AuditFormatJSON = "json"
+)
+
+// AuditOffice : an officeCode, Lines is the number of input lines of it
+type AuditOffice struct {
+	OfficeCode string   `json:"officeCode"`
+	Lines      int      `json:"lines"`
+	Nodes      []string `json:"nodeCodes,omitempty"`
+}
+
+// AuditNode : a nodeCode and the officeCodes mapped to it
+type AuditNode struct {
+	NodeCode string   `json:"nodeCode"`
+	Offices  []string `json:"officeCodes,omitempty"`
+	Lines    int      `json:"lines"`
+}
+
+// AuditGLB : a serviceCode/glbId and the nodeCodes mapped to it
+type AuditGLB struct {
+	ServiceCode string   `json:"serviceCode"`
+	GLBID       string   `json:"glbId"`
+	Nodes       []string `json:"nodeCodes"`
+}
+
+// AuditMultiGLB : a serviceCode of an officeCode rejected by multi-glb, Lines is the number of input lines of the officeCode
+type AuditMultiGLB struct {
+	OfficeCode  string   `json:"officeCode"`
+	ServiceCode string   `json:"serviceCode"`
+	Candidates  []string `json:"candidates"`
+	Lines       int      `json:"lines"`
+}
+
+// AuditReport : inconsistencies between the mappings and the input
+//
+// OfficesWithoutNode : officeCodes of the input that are not in the officeCode-nodeCode mapping
+// NodesWithoutGLB : nodeCodes of the officeCode-nodeCode mapping that are not in the nodeCode-glbId mapping
+// UnusedNodes : nodeCodes of the nodeCode-glbId mapping that no officeCode is mapped to
+// UnusedGLBs : serviceCode/glbIds that no officeCode of the input reaches
+// MultiNodeOffices : officeCodes mapped to more than one nodeCode
+// UncoveredServiceCodes : serviceCodes that no officeCode of the input reaches, they would have no netMask
+// MultiGLBRejected : serviceCodes of officeCodes of the input rejected by multi-glb on purpose, not counted in Problems
+type AuditReport struct {
+	InputLines            int              `json:"inputLines"`
+	InputOffices          int              `json:"inputOffices"`
+	OfficeNodes           int              `json:"officeNodeMappings"`
+	NodeGLBIDs            int              `json:"nodeGLBIdMappings"`
+	OfficesWithoutNode    []*AuditOffice   `json:"officesWithoutNode"`
+	NodesWithoutGLB       []*AuditNode     `json:"nodesWithoutGlbId"`
+	UnusedNodes           []string         `json:"unusedNodes"`
+	UnusedGLBs            []*AuditGLB      `json:"unusedGlbIds"`
+	MultiNodeOffices      []*AuditOffice   `json:"officesWithSeveralNodes"`
+	UncoveredServiceCodes []string         `json:"serviceCodesWithoutCoverage"`
+	MultiGLBRejected      []*AuditMultiGLB `json:"multiGlbRejected"`
+}
+
+// Problems : number of entries of every section
+func (r *AuditReport) Problems() int {
+	return len(r.OfficesWithoutNode) + len(r.NodesWithoutGLB) + len(r.UnusedNodes) +
+		len(r.UnusedGLBs) + len(r.MultiNodeOffices) + len(r.UncoveredServiceCodes)
+}
+
+// InputOfficeLines : number of input lines of each officeCode, of recs and of the unknown office code
+// and multi-glb rejects of stats
+// a line is counted once, even if it is split by the mapping or by conflicts, or some of its serviceCodes are rejected
+func InputOfficeLines(recs []*IpmsRecord, stats *InputStats) map[string]int {
+	type lineKey struct {
+		source string
+		line   int
+	}
+	seen := map[lineKey]bool{}
+	offices := map[string]int{}
+	for _, rec := range recs {
+		k := lineKey{rec.Source, rec.Line}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		offices[rec.OfficeCode]++
+	}
+	if stats != nil {
+		for _, r := range stats.Rejects() {
+			switch r.Reason {
+			case RejectUnknownOfficeCode:
+				offices[r.OfficeCode]++
+			case RejectMultiGLBRejected:
+				k := lineKey{r.File, r.Line}
+				if seen[k] {
+					continue
+				}
+				seen[k] = true
+				offices[r.OfficeCode]++
+			}
+		}
+	}
+	return offices
+}
+
+func sortedKeys(m map[string]bool) []string {
+	l := []string{}
+	for k := range m {
+		l = append(l, k)
+	}
+	sort.Strings(l)
+	return l
+}
+
+// AuditMapping : cross-references the mapping tables and the officeCodes of the input
+// offices is the number of input lines of each officeCode, see InputOfficeLines
+// decisions are the multi-glb decisions of the mapping, see ResolveMultiGLB
+func AuditMapping(t *MappingTables, decisions []*MultiGLBDecision, offices map[string]int) *AuditReport {
+	r := &AuditReport{
+		InputOffices:          len(offices),
+		OfficeNodes:           len(t.OfficeNodes),
+		NodeGLBIDs:            len(t.NodeGLBIDs),
+		OfficesWithoutNode:    []*AuditOffice{},
+		NodesWithoutGLB:       []*AuditNode{},
+		UnusedNodes:           []string{},
+		UnusedGLBs:            []*AuditGLB{},
+		MultiNodeOffices:      []*AuditOffice{},
+		UncoveredServiceCodes: []string{},
+		MultiGLBRejected:      []*AuditMultiGLB{},
+	}
+	for _, n := range offices {
+		r.InputLines += n
+	}
+
+	officeNodes := map[string]map[string]bool{}
+	nodeOffices := map[string]map[string]bool{}
+	for _, m := range t.OfficeNodes {
+		if officeNodes[m.OfficeCode] == nil {
+			officeNodes[m.OfficeCode] = map[string]bool{}
+		}
+		officeNodes[m.OfficeCode][m.NodeCode] = true
+		if nodeOffices[m.NodeCode] == nil {
+			nodeOffices[m.NodeCode] = map[string]bool{}
+		}
+		nodeOffices[m.NodeCode][m.OfficeCode] = true
+	}
+	nodeGLBs := map[string][]glbKey{}
+	glbNodes := map[glbKey]map[string]bool{}
+	for _, m := range t.NodeGLBIDs {
+		k := glbKey{m.ServiceCode, m.GLBID}
+		nodeGLBs[m.NodeCode] = append(nodeGLBs[m.NodeCode], k)
+		if glbNodes[k] == nil {
+			glbNodes[k] = map[string]bool{}
+		}
+		glbNodes[k][m.NodeCode] = true
+	}
+
+	inputOffices := map[string]bool{}
+	for o := range offices {
+		inputOffices[o] = true
+	}
+	for _, o := range sortedKeys(inputOffices) {
+		if officeNodes[o] == nil {
+			r.OfficesWithoutNode = append(r.OfficesWithoutNode, &AuditOffice{OfficeCode: o, Lines: offices[o]})
+		}
+	}
+
+	mappedNodes := map[string]bool{}
+	for n := range nodeOffices {
+		mappedNodes[n] = true
+	}
+	for _, n := range sortedKeys(mappedNodes) {
+		if nodeGLBs[n] != nil {
+			continue
+		}
+		an := &AuditNode{NodeCode: n, Offices: sortedKeys(nodeOffices[n])}
+		for _, o := range an.Offices {
+			an.Lines += offices[o]
+		}
+		r.NodesWithoutGLB = append(r.NodesWithoutGLB, an)
+	}
+
+	glbNodeCodes := map[string]bool{}
+	for n := range nodeGLBs {
+		glbNodeCodes[n] = true
+	}
+	for _, n := range sortedKeys(glbNodeCodes) {
+		if nodeOffices[n] == nil {
+			r.UnusedNodes = append(r.UnusedNodes, n)
+		}
+	}
+
+	officeCodes := map[string]bool{}
+	for o := range officeNodes {
+		officeCodes[o] = true
+	}
+	for _, o := range sortedKeys(officeCodes) {
+		if len(officeNodes[o]) > 1 {
+			r.MultiNodeOffices = append(r.MultiNodeOffices, &AuditOffice{OfficeCode: o, Lines: offices[o], Nodes: sortedKeys(officeNodes[o])})
+		}
+	}
+
+	reached := map[glbKey]bool{}
+	for o := range inputOffices {
+		for n := range officeNodes[o] {
+			for _, k := range nodeGLBs[n] {
+				reached[k] = true
+			}
+		}
+	}
+	var glbs []glbKey
+	for k := range glbNodes {
+		glbs = append(glbs, k)
+	}
+	sort.Slice(glbs, func(i, j int) bool {
+		if glbs[i].serviceCode != glbs[j].serviceCode {
+			return glbs[i].serviceCode < glbs[j].serviceCode
+		}
+		return glbs[i].glbID < glbs[j].glbID
+	})
+	serviceCodes := map[string]bool{}
+	coveredServiceCodes := map[string]bool{}
+	for _, k := range glbs {
+		serviceCodes[k.serviceCode] = true
+		if reached[k] {
+			coveredServiceCodes[k.serviceCode] = true
+			continue
+		}
+		r.UnusedGLBs = append(r.UnusedGLBs, &AuditGLB{ServiceCode: k.serviceCode, GLBID: k.glbID, Nodes: sortedKeys(glbNodes[k])})
+	}
+	for _, sc := range sortedKeys(serviceCodes) {
+		if !coveredServiceCodes[sc] {
+			r.UncoveredServiceCodes = append(r.UncoveredServiceCodes, sc)
+		}
+	}
+
+	// decisions are sorted by officeCode
+	for _, d := range decisions {
+		if len(d.GLBIDs) == 0 && offices[d.OfficeCode] > 0 {
+			r.MultiGLBRejected = append(r.MultiGLBRejected, &AuditMultiGLB{
+				OfficeCode: d.OfficeCode, ServiceCode: d.ServiceCode, Candidates: d.Candidates, Lines: offices[d.OfficeCode],
+			})
+		}
+	}
+	return r
+}
+
+// Print : text report, a section per kind of inconsistency
+func (r *AuditReport) Print(w io.Writer) {
+	fmt.Fprintf(w, "input lines[%d], input officeCodes[%d], officeCode-nodeCode mappings[%d], nodeCode-glbId mappings[%d]\n",
+		r.InputLines, r.InputOffices, r.OfficeNodes, r.NodeGLBIDs)
+
+	fmt.Fprintf(w, "officeCodes of input without nodeCode[%d]\n", len(r.OfficesWithoutNode))
+	for _, o := range r.OfficesWithoutNode {
+		fmt.Fprintf(w, "  officeCode[%s], lines[%d]\n", o.OfficeCode, o.Lines)
+	}
+	fmt.Fprintf(w, "nodeCodes without glbId[%d]\n", len(r.NodesWithoutGLB))
+	for _, n := range r.NodesWithoutGLB {
+		fmt.Fprintf(w, "  nodeCode[%s], officeCodes[%s], lines[%d]\n", n.NodeCode, strings.Join(n.Offices, ","), n.Lines)
+	}
+	fmt.Fprintf(w, "nodeCodes that no officeCode uses[%d]\n", len(r.UnusedNodes))
+	for _, n := range r.UnusedNodes {
+		fmt.Fprintf(w, "  nodeCode[%s]\n", n)
+	}
+	fmt.Fprintf(w, "glbIds that no officeCode of input uses[%d]\n", len(r.UnusedGLBs))
+	for _, g := range r.UnusedGLBs {
+		fmt.Fprintf(w, "  serviceCode[%s], glbId[%s], nodeCodes[%s]\n", g.ServiceCode, g.GLBID, strings.Join(g.Nodes, ","))
+	}
+	fmt.Fprintf(w, "officeCodes mapped to several nodeCodes[%d]\n", len(r.MultiNodeOffices))
+	for _, o := range r.MultiNodeOffices {
+		fmt.Fprintf(w, "  officeCode[%s], nodeCodes[%s], lines[%d]\n", o.OfficeCode, strings.Join(o.Nodes, ","), o.Lines)
+	}
+	fmt.Fprintf(w, "serviceCodes without coverage[%d]\n", len(r.UncoveredServiceCodes))
+	for _, sc := range r.UncoveredServiceCodes {
+		fmt.Fprintf(w, "  serviceCode[%s]\n", sc)
+	}
+	fmt.Fprintf(w, "serviceCodes of officeCodes rejected by multi-glb[%d]\n", len(r.MultiGLBRejected))
+	for _, m := range r.MultiGLBRejected {
+		fmt.Fprintf(w, "  officeCode[%s], serviceCode[%s], candidates[%s], lines[%d]\n", m.OfficeCode, m.ServiceCode, strings.Join(m.Candidates, ","), m.Lines)
+	}
+}
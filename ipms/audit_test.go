@@ -0,0 +1,94 @@
+package ipms
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestInputOfficeLines(t *testing.T) {
+	recs := testRecords(t, []string{"S A 00 10.0.0.0/25", "S A 00 10.0.0.128/25", "T B 00 10.0.0.0/24", "S A 00 10.0.1.0/24"})
+	// a line split into two records and mapped to two serviceCodes
+	for i, line := range []int{1, 1, 1, 2} {
+		recs[i].Source, recs[i].Line = "in.csv", line
+	}
+	recs[3].OfficeCode = "R00002"
+	stats := &InputStats{Stats: []*SourceStats{{Rejects: []*Reject{
+		{File: "in.csv", Line: 3, Reason: RejectUnknownOfficeCode, OfficeCode: "R00009"},
+		{File: "in.csv", Line: 4, Reason: RejectInvalidIP, OfficeCode: "R00001"},
+		// U of line 1 rejected, the line has records of S and T
+		{File: "in.csv", Line: 1, Reason: RejectMultiGLBRejected, OfficeCode: "R00001"},
+		{File: "in.csv", Line: 5, Reason: RejectMultiGLBRejected, OfficeCode: "R00003"},
+		{File: "in.csv", Line: 5, Reason: RejectMultiGLBRejected, OfficeCode: "R00003"},
+	}}}}
+
+	got := InputOfficeLines(recs, stats)
+	want := map[string]int{"R00001": 1, "R00002": 1, "R00009": 1, "R00003": 1}
+	if len(got) != len(want) {
+		t.Errorf("offices %v, want %v", got, want)
+	}
+	for o, n := range want {
+		if got[o] != n {
+			t.Errorf("officeCode[%s], lines[%d], want %d", o, got[o], n)
+		}
+	}
+}
+
+func TestAuditMapping(t *testing.T) {
+	tables := &MappingTables{
+		OfficeNodes: []OfficeNodeMapping{
+			{OfficeCode: "R1", NodeCode: "N1"},
+			{OfficeCode: "R2", NodeCode: "N2"},
+			{OfficeCode: "R2", NodeCode: "N3"},
+			{OfficeCode: "R4", NodeCode: "N4"},
+			{OfficeCode: "R5", NodeCode: "N1"},
+		},
+		NodeGLBIDs: []NodeGLBIDMapping{
+			{NodeCode: "N1", ServiceCode: "S", GLBID: "A"},
+			{NodeCode: "N2", ServiceCode: "S", GLBID: "B"},
+			{NodeCode: "N3", ServiceCode: "T", GLBID: "C"},
+			{NodeCode: "N5", ServiceCode: "U", GLBID: "D"},
+		},
+	}
+	decisions := []*MultiGLBDecision{
+		{OfficeCode: "R1", ServiceCode: "S", Candidates: []string{"A", "X"}, Policy: MultiGLBPreferGLB, GLBIDs: []string{"A"}},
+		{OfficeCode: "R2", ServiceCode: "S", Candidates: []string{"B", "X"}, Policy: MultiGLBReject},
+		// not in the input
+		{OfficeCode: "R5", ServiceCode: "S", Candidates: []string{"A", "X"}, Policy: MultiGLBReject},
+	}
+	offices := map[string]int{"R1": 3, "R2": 2, "R3": 1, "R4": 1}
+
+	r := AuditMapping(tables, decisions, offices)
+	if r.InputLines != 7 || r.InputOffices != 4 || r.OfficeNodes != 5 || r.NodeGLBIDs != 4 {
+		t.Errorf("input lines[%d], offices[%d], officeNodes[%d], nodeGLBIds[%d], want 7, 4, 5, 4", r.InputLines, r.InputOffices, r.OfficeNodes, r.NodeGLBIDs)
+	}
+
+	var b bytes.Buffer
+	r.Print(&b)
+	for _, want := range []string{
+		"officeCodes of input without nodeCode[1]\n  officeCode[R3], lines[1]\n",
+		"nodeCodes without glbId[1]\n  nodeCode[N4], officeCodes[R4], lines[1]\n",
+		"nodeCodes that no officeCode uses[1]\n  nodeCode[N5]\n",
+		"glbIds that no officeCode of input uses[1]\n  serviceCode[U], glbId[D], nodeCodes[N5]\n",
+		"officeCodes mapped to several nodeCodes[1]\n  officeCode[R2], nodeCodes[N2,N3], lines[2]\n",
+		"serviceCodes without coverage[1]\n  serviceCode[U]\n",
+		"serviceCodes of officeCodes rejected by multi-glb[1]\n  officeCode[R2], serviceCode[S], candidates[B,X], lines[2]\n",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("report\n%s\nwant\n%s", b.String(), want)
+		}
+	}
+	// multi-glb rejects are on purpose
+	if r.Problems() != 6 {
+		t.Errorf("problems[%d], want 6", r.Problems())
+	}
+
+	// a consistent mapping
+	r = AuditMapping(&MappingTables{
+		OfficeNodes: []OfficeNodeMapping{{OfficeCode: "R1", NodeCode: "N1"}},
+		NodeGLBIDs:  []NodeGLBIDMapping{{NodeCode: "N1", ServiceCode: "S", GLBID: "A"}},
+	}, nil, map[string]int{"R1": 1})
+	if r.Problems() != 0 || len(r.MultiGLBRejected) != 0 {
+		t.Errorf("problems[%d], %+v, want none", r.Problems(), r)
+	}
+}
@@ -2,17 +2,26 @@ package ipms
 
 import "net"
 
-var allFF = net.ParseIP("255.255.255.255").To4()
-
 func x(s string) net.IP { return net.ParseIP(s) }
 
-// Range2CIDRs :
+// normalizeIP : 4 bytes for IPv4 (including IPv4-mapped IPv6), 16 bytes for IPv6
+func normalizeIP(ip net.IP) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip.To16()
+}
+
+// Range2CIDRs : a1, a2 must be the same address family
 func Range2CIDRs(a1, a2 net.IP) (r []*net.IPNet) {
-	maxLen := 32
-	a1 = a1.To4()
-	a2 = a2.To4()
+	a1 = normalizeIP(a1)
+	a2 = normalizeIP(a2)
+	if a1 == nil || a2 == nil || len(a1) != len(a2) {
+		return nil
+	}
+	maxLen := len(a1) * 8
 	for cmp(a1, a2) <= 0 {
-		l := 32
+		l := maxLen
 		for l > 0 {
 			m := net.CIDRMask(l-1, maxLen)
 			if cmp(a1, first(a1, m)) != 0 || cmp(last(a1, m), a2) > 0 {
@@ -22,7 +31,7 @@ func Range2CIDRs(a1, a2 net.IP) (r []*net.IPNet) {
 		}
 		r = append(r, &net.IPNet{IP: a1, Mask: net.CIDRMask(l, maxLen)})
 		a1 = last(a1, net.CIDRMask(l, maxLen))
-		if cmp(a1, allFF) == 0 {
+		if isAllFF(a1) {
 			break
 		}
 		a1 = next(a1)
@@ -30,6 +39,15 @@ func Range2CIDRs(a1, a2 net.IP) (r []*net.IPNet) {
 	return r
 }
 
+func isAllFF(ip net.IP) bool {
+	for _, b := range ip {
+		if b != 0xff {
+			return false
+		}
+	}
+	return true
+}
+
 func next(ip net.IP) net.IP {
 	n := len(ip)
 	out := make(net.IP, n)
@@ -50,7 +68,14 @@ func next(ip net.IP) net.IP {
 	return out
 }
 
+// cmp : IPv4 addresses sort before IPv6 addresses
 func cmp(ip1, ip2 net.IP) int {
+	if len(ip1) != len(ip2) {
+		if len(ip1) < len(ip2) {
+			return -1
+		}
+		return 1
+	}
 	l := len(ip1)
 	for i := 0; i < l; i++ {
 		if ip1[i] == ip2[i] {
@@ -76,3 +101,8 @@ func last(ip net.IP, mask net.IPMask) net.IP {
 	}
 	return out
 }
+
+// bitAt : i-th bit from the most significant bit
+func bitAt(ip net.IP, i int) int {
+	return int(ip[i/8]>>uint(7-i%8)) & 1
+}
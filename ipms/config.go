@@ -4,21 +4,51 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"path/filepath"
 
 	yaml "gopkg.in/yaml.v1"
 )
 
 // YmlConfig :
 type YmlConfig struct {
-	LogDir              string `yaml:"log-directory"`
-	LogLevel            string `yaml:"log-level"`
-	OfficeNodeAPI       string `yaml:"mapping-office-node-api"`
-	NodeGLBIDAPI        string `yaml:"mapping-node-glbid-api"`
-	IPRoutingInfoCfgAPI string `yaml:"import-ipms-api"`
+	LogDir              string          `yaml:"log-directory"`
+	LogLevel            string          `yaml:"log-level"`
+	OfficeNodeAPI       string          `yaml:"mapping-office-node-api"`
+	NodeGLBIDAPI        string          `yaml:"mapping-node-glbid-api"`
+	OfficeNodeFile      string          `yaml:"mapping-office-node-file"`
+	NodeGLBIDFile       string          `yaml:"mapping-node-glbid-file"`
+	IPRoutingInfoCfgAPI string          `yaml:"import-ipms-api"`
+	ConflictPolicy      string          `yaml:"conflict-policy"`
+	ImportMode          string          `yaml:"import-mode"`
+	IPMSDeltaAPI        string          `yaml:"import-ipms-delta-api"`
+	LastImportFile      string          `yaml:"last-import-file"`
+	InputFormat         string          `yaml:"input-format"`
+	InputSchema         *InputSchema    `yaml:"input-schema"`
+	InputEncoding       string          `yaml:"input-encoding"`
+	InputArchiveEntry   string          `yaml:"input-archive-entry"`
+	Filters             []*FilterRule   `yaml:"filters"`
+	RejectFile          string          `yaml:"reject-file"`
+	RejectFormat        string          `yaml:"reject-format"`
+	Safety              *SafetyConfig   `yaml:"safety"`
+	HistoryDirectory    string          `yaml:"history-directory"`
+	HistoryKeep         int             `yaml:"history-keep"`
+	HTTP                *HTTPConfig     `yaml:"http"`
+	MappingCacheFile    string          `yaml:"mapping-cache-file"`
+	MappingCacheMaxAge  string          `yaml:"mapping-cache-max-age"`
+	MultiGLB            *MultiGLBConfig `yaml:"multi-glb"`
+	OverrideFile        string          `yaml:"override-file"`
+
+	WatchDirectory  string `yaml:"watch-directory"`
+	WatchPattern    string `yaml:"watch-pattern"`
+	WatchInterval   string `yaml:"watch-interval"`
+	WatchStableTime string `yaml:"watch-stable-time"`
+	WatchDoneMarker bool   `yaml:"watch-done-marker"`
+
+	client *Client
 }
 
-// NewYmlConfig :
-func NewYmlConfig(ymlConfigFilePath string) (*YmlConfig, error) {
+// NewInputYmlConfig : config of log and input only, for the commands that do not import to the config server
+func NewInputYmlConfig(ymlConfigFilePath string) (*YmlConfig, error) {
 	originData, err := ioutil.ReadFile(ymlConfigFilePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config, %v", err)
@@ -34,15 +64,101 @@ func NewYmlConfig(ymlConfigFilePath string) (*YmlConfig, error) {
 	if cfg.LogLevel == "" {
 		cfg.LogLevel = "info"
 	}
-	if cfg.OfficeNodeAPI == "" {
-		return nil, errors.New("mapping-office-node-api not exist")
+	if cfg.InputSchema != nil {
+		if err := cfg.InputSchema.validate(); err != nil {
+			return nil, fmt.Errorf("invalid input-schema, %v", err)
+		}
+	}
+	if cfg.InputEncoding == "" {
+		cfg.InputEncoding = EncodingAuto
+	}
+	if _, err := newLineDecoder(cfg.InputEncoding); err != nil {
+		return nil, fmt.Errorf("invalid input-encoding, %v", err)
+	}
+	if _, err := filepath.Match(cfg.InputArchiveEntry, ""); err != nil {
+		return nil, fmt.Errorf("invalid input-archive-entry, %v", err)
+	}
+	if _, err := cfg.Client(); err != nil {
+		return nil, fmt.Errorf("invalid http, %v", err)
+	}
+	if err := compileFilters(&cfg); err != nil {
+		return nil, fmt.Errorf("invalid filters, %v", err)
+	}
+	switch cfg.RejectFormat {
+	case "", RejectFormatCSV, RejectFormatJSONL:
+	default:
+		return nil, fmt.Errorf("invalid reject-format, %s", cfg.RejectFormat)
+	}
+	return &cfg, nil
+}
+
+// NewYmlConfig :
+func NewYmlConfig(ymlConfigFilePath string) (*YmlConfig, error) {
+	cfg, err := NewInputYmlConfig(ymlConfigFilePath)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.OfficeNodeAPI == "" && cfg.OfficeNodeFile == "" {
+		return nil, errors.New("mapping-office-node-api or mapping-office-node-file not exist")
+	}
+	if cfg.NodeGLBIDAPI == "" && cfg.NodeGLBIDFile == "" {
+		return nil, errors.New("mapping-node-glbid-api or mapping-node-glbid-file not exist")
 	}
-	if cfg.NodeGLBIDAPI == "" {
-		return nil, errors.New("mapping-node-glbid-api not exist")
+	for _, f := range []string{cfg.OfficeNodeFile, cfg.NodeGLBIDFile} {
+		if f != "" && mappingFileFormat(f) == "" {
+			return nil, fmt.Errorf("invalid mapping file, %s, must be .csv, .yml, .yaml or .json", f)
+		}
 	}
 	if cfg.IPRoutingInfoCfgAPI == "" {
 		return nil, errors.New("import-ipms-api not exist")
 	}
+	if cfg.ConflictPolicy == "" {
+		cfg.ConflictPolicy = ConflictPolicyReport
+	}
+	if !validConflictPolicy(cfg.ConflictPolicy) {
+		return nil, fmt.Errorf("invalid conflict-policy, %s", cfg.ConflictPolicy)
+	}
+	if cfg.ImportMode == "" {
+		cfg.ImportMode = ImportModeFull
+	}
+	switch cfg.ImportMode {
+	case ImportModeFull:
+	case ImportModeDelta:
+		if cfg.IPMSDeltaAPI == "" {
+			return nil, errors.New("import-ipms-delta-api not exist")
+		}
+		if cfg.LastImportFile == "" {
+			return nil, errors.New("last-import-file not exist")
+		}
+	default:
+		return nil, fmt.Errorf("invalid import-mode, %s", cfg.ImportMode)
+	}
+	if cfg.HistoryKeep < 0 {
+		return nil, fmt.Errorf("invalid history-keep[%d]", cfg.HistoryKeep)
+	}
+	if cfg.Safety != nil {
+		if err := cfg.Safety.validate(cfg.LastImportFile); err != nil {
+			return nil, fmt.Errorf("invalid safety, %v", err)
+		}
+	}
+	if _, err := cfg.mappingCacheMaxAge(); err != nil {
+		return nil, err
+	}
+	if cfg.MultiGLB != nil {
+		if err := cfg.MultiGLB.validate(); err != nil {
+			return nil, fmt.Errorf("invalid multi-glb, %v", err)
+		}
+	}
+	if cfg.OverrideFile != "" {
+		if _, err := LoadOverrides(cfg.OverrideFile); err != nil {
+			return nil, fmt.Errorf("invalid override-file, %v", err)
+		}
+	}
+	if cfg.WatchDirectory != "" {
+		if _, err := cfg.WatchConfig(); err != nil {
+			return nil, err
+		}
+	}
 
-	return &cfg, nil
+	return cfg, nil
 }
@@ -0,0 +1,181 @@
+package ipms
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/castisdev/cilog"
+)
+
+// conflict policies
+const (
+	ConflictPolicyFail         = "fail"
+	ConflictPolicyMostSpecific = "most-specific"
+	ConflictPolicyFirst        = "first"
+	ConflictPolicyReport       = "report"
+)
+
+func validConflictPolicy(policy string) bool {
+	switch policy {
+	case ConflictPolicyFail, ConflictPolicyMostSpecific, ConflictPolicyFirst, ConflictPolicyReport:
+		return true
+	}
+	return false
+}
+
+// Conflict : an address block assigned to different GLB IDs of the same service code
+// CIDR is the overlapped block, Records are every record covering it
+type Conflict struct {
+	ServiceCode string
+	CIDR        string
+	Records     []*IpmsRecord
+}
+
+func (c *Conflict) String() string {
+	var recs []string
+	for _, rec := range c.Records {
+		recs = append(recs, fmt.Sprintf("[%sline[%d], officeCode[%s], glbId[%s], netCode[%s], netMask[%v]]", sourcePrefix(rec), rec.Line, rec.OfficeCode, rec.GLBID, rec.NetCode, rec.IPNet))
+	}
+	return fmt.Sprintf("serviceCode[%s], netMask[%s], %s", c.ServiceCode, c.CIDR, strings.Join(recs, ", "))
+}
+
+type conflictSort []*IpmsRecord
+
+func (s conflictSort) Len() int {
+	return len(s)
+}
+func (s conflictSort) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s conflictSort) Less(i, j int) bool {
+	if s[i].ServiceCode != s[j].ServiceCode {
+		return s[i].ServiceCode < s[j].ServiceCode
+	}
+	if c := cmp(s[i].IPStart, s[j].IPStart); c != 0 {
+		return c < 0
+	}
+	return s[i].Prefix < s[j].Prefix
+}
+
+// FindConflicts :
+func FindConflicts(recs []*IpmsRecord) []*Conflict {
+	sorted := make([]*IpmsRecord, len(recs))
+	copy(sorted, recs)
+	sort.Stable(conflictSort(sorted))
+
+	var conflicts []*Conflict
+	index := map[string]*Conflict{}
+
+	// blocks either nest or are disjoint, so the stack holds every block containing the current one
+	var stack []*IpmsRecord
+	for _, rec := range sorted {
+		for len(stack) > 0 {
+			top := stack[len(stack)-1]
+			if top.ServiceCode == rec.ServiceCode && cmp(top.Range().End, rec.IPStart) >= 0 {
+				break
+			}
+			stack = stack[:len(stack)-1]
+		}
+
+		for _, s := range stack {
+			if s.GLBID == rec.GLBID {
+				continue
+			}
+			key := rec.ServiceCode + "|" + rec.IPNet.String()
+			c, ok := index[key]
+			if !ok {
+				c = &Conflict{ServiceCode: rec.ServiceCode, CIDR: rec.IPNet.String(), Records: []*IpmsRecord{rec}}
+				index[key] = c
+				conflicts = append(conflicts, c)
+			}
+			c.add(s)
+		}
+		stack = append(stack, rec)
+	}
+	return conflicts
+}
+
+func (c *Conflict) add(rec *IpmsRecord) {
+	for _, r := range c.Records {
+		if r == rec {
+			return
+		}
+	}
+	c.Records = append(c.Records, rec)
+}
+
+// ResolveConflicts : applies policy to the conflicts of recs
+// most-specific : the longest prefix keeps the overlapped block
+// first : the record that comes first in the input keeps the overlapped block
+func ResolveConflicts(recs []*IpmsRecord, policy string) ([]*IpmsRecord, error) {
+	conflicts := FindConflicts(recs)
+	for _, c := range conflicts {
+		cilog.Warningf("conflict, %v", c)
+	}
+	if len(conflicts) == 0 {
+		return recs, nil
+	}
+
+	switch policy {
+	case ConflictPolicyReport, "":
+		cilog.Warningf("found conflicts[%d], policy[%s], records are kept as is", len(conflicts), ConflictPolicyReport)
+		return recs, nil
+	case ConflictPolicyFail:
+		return nil, fmt.Errorf("found conflicts[%d], policy[%s]", len(conflicts), policy)
+	case ConflictPolicyMostSpecific, ConflictPolicyFirst:
+	default:
+		return nil, fmt.Errorf("invalid conflict policy, %s", policy)
+	}
+
+	order := map[*IpmsRecord]int{}
+	for i, rec := range recs {
+		order[rec] = i
+	}
+	beats := func(a, b *IpmsRecord) bool {
+		if policy == ConflictPolicyMostSpecific && a.Prefix != b.Prefix {
+			return a.Prefix > b.Prefix
+		}
+		return order[a] < order[b]
+	}
+
+	lost := map[*IpmsRecord][]IPRange{}
+	for _, c := range conflicts {
+		winner := c.Records[0]
+		for _, rec := range c.Records[1:] {
+			if beats(rec, winner) {
+				winner = rec
+			}
+		}
+		block := c.Records[0].Range()
+		for _, rec := range c.Records {
+			if rec.GLBID != winner.GLBID {
+				lost[rec] = append(lost[rec], block)
+			}
+		}
+		cilog.Infof("resolve conflict, policy[%s], serviceCode[%s], netMask[%s], glbId[%s], line[%d]", policy, c.ServiceCode, c.CIDR, winner.GLBID, winner.Line)
+	}
+
+	var resolved []*IpmsRecord
+	for _, rec := range recs {
+		blocks, ok := lost[rec]
+		if !ok {
+			resolved = append(resolved, rec)
+			continue
+		}
+		for _, r := range subtractRanges([]IPRange{rec.Range()}, mergeRanges(blocks)) {
+			for _, cidr := range r.CIDRs() {
+				newRec, err := NewRecordFromCIDR(rec.ServiceCode, rec.GLBID, rec.NetCode, rec.OfficeCode, cidr)
+				if err != nil {
+					return nil, err
+				}
+				newRec.Source = rec.Source
+				newRec.Line = rec.Line
+				newRec.Raw = rec.Raw
+				resolved = append(resolved, newRec)
+			}
+		}
+	}
+	cilog.Infof("success to resolve conflicts[%d], records[%d] to [%d]", len(conflicts), len(recs), len(resolved))
+	return resolved, nil
+}
@@ -0,0 +1,199 @@
+package ipms
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// testRangeRecords : records of "serviceCode glbId cidr" or "serviceCode glbId start-end",
+// the line of a record is the index of its spec, from 1
+func testRangeRecords(t *testing.T, specs []string) []*IpmsRecord {
+	var recs []*IpmsRecord
+	for i, s := range specs {
+		f := strings.Split(s, " ")
+		var cidrs []*net.IPNet
+		if strings.Contains(f[2], "/") {
+			_, ipNet, err := net.ParseCIDR(f[2])
+			if err != nil {
+				t.Fatal(err)
+			}
+			cidrs = append(cidrs, ipNet)
+		} else {
+			cidrs = testRange(f[2]).CIDRs()
+		}
+		for _, cidr := range cidrs {
+			rec, err := NewRecordFromCIDR(f[0], f[1], "00", "R00001", cidr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec.Line = i + 1
+			recs = append(recs, rec)
+		}
+	}
+	return recs
+}
+
+// glbCoverage : "serviceCode/glbId range,range ..." of recs, sorted
+func glbCoverage(recs []*IpmsRecord) string {
+	ranges := map[string][]IPRange{}
+	for _, rec := range recs {
+		k := rec.ServiceCode + "/" + rec.GLBID
+		ranges[k] = append(ranges[k], rec.Range())
+	}
+	var out []string
+	for k, rs := range ranges {
+		var l []string
+		for _, r := range mergeRanges(rs) {
+			l = append(l, r.String())
+		}
+		out = append(out, k+" "+strings.Join(l, ","))
+	}
+	sort.Strings(out)
+	return strings.Join(out, " ")
+}
+
+func TestResolveConflicts(t *testing.T) {
+	const failed = "error"
+	tests := []struct {
+		name      string
+		recs      []string
+		conflicts int
+		want      map[string]string // coverage by policy, failed when the policy returns an error
+	}{
+		{
+			name:      "nested",
+			recs:      []string{"S A 10.0.0.0/16", "S B 10.0.1.0/24"},
+			conflicts: 1,
+			want: map[string]string{
+				ConflictPolicyReport:       "S/A 10.0.0.0-10.0.255.255 S/B 10.0.1.0-10.0.1.255",
+				ConflictPolicyFail:         failed,
+				ConflictPolicyMostSpecific: "S/A 10.0.0.0-10.0.0.255,10.0.2.0-10.0.255.255 S/B 10.0.1.0-10.0.1.255",
+				ConflictPolicyFirst:        "S/A 10.0.0.0-10.0.255.255",
+			},
+		},
+		{
+			name:      "nested, the inner block first",
+			recs:      []string{"S B 10.0.1.0/24", "S A 10.0.0.0/16"},
+			conflicts: 1,
+			want: map[string]string{
+				ConflictPolicyReport:       "S/A 10.0.0.0-10.0.255.255 S/B 10.0.1.0-10.0.1.255",
+				ConflictPolicyFail:         failed,
+				ConflictPolicyMostSpecific: "S/A 10.0.0.0-10.0.0.255,10.0.2.0-10.0.255.255 S/B 10.0.1.0-10.0.1.255",
+				ConflictPolicyFirst:        "S/A 10.0.0.0-10.0.0.255,10.0.2.0-10.0.255.255 S/B 10.0.1.0-10.0.1.255",
+			},
+		},
+		{
+			name:      "three levels",
+			recs:      []string{"S A 10.0.0.0/16", "S B 10.0.0.0/24", "S C 10.0.0.0/25"},
+			conflicts: 2,
+			want: map[string]string{
+				ConflictPolicyReport:       "S/A 10.0.0.0-10.0.255.255 S/B 10.0.0.0-10.0.0.255 S/C 10.0.0.0-10.0.0.127",
+				ConflictPolicyFail:         failed,
+				ConflictPolicyMostSpecific: "S/A 10.0.1.0-10.0.255.255 S/B 10.0.0.128-10.0.0.255 S/C 10.0.0.0-10.0.0.127",
+				ConflictPolicyFirst:        "S/A 10.0.0.0-10.0.255.255",
+			},
+		},
+		{
+			// 10.0.0.0/24 10.0.1.0/25 of A and 10.0.0.128/25 10.0.1.0/24 of B
+			name:      "partial overlap of ranges",
+			recs:      []string{"S A 10.0.0.0-10.0.1.127", "S B 10.0.0.128-10.0.1.255"},
+			conflicts: 2,
+			want: map[string]string{
+				ConflictPolicyReport:       "S/A 10.0.0.0-10.0.1.127 S/B 10.0.0.128-10.0.1.255",
+				ConflictPolicyFail:         failed,
+				ConflictPolicyMostSpecific: "S/A 10.0.0.0-10.0.0.127,10.0.1.0-10.0.1.127 S/B 10.0.0.128-10.0.0.255,10.0.1.128-10.0.1.255",
+				ConflictPolicyFirst:        "S/A 10.0.0.0-10.0.1.127 S/B 10.0.1.128-10.0.1.255",
+			},
+		},
+		{
+			name:      "identical",
+			recs:      []string{"S B 10.0.0.0/24", "S A 10.0.0.0/24"},
+			conflicts: 1,
+			want: map[string]string{
+				ConflictPolicyReport:       "S/A 10.0.0.0-10.0.0.255 S/B 10.0.0.0-10.0.0.255",
+				ConflictPolicyFail:         failed,
+				ConflictPolicyMostSpecific: "S/B 10.0.0.0-10.0.0.255",
+				ConflictPolicyFirst:        "S/B 10.0.0.0-10.0.0.255",
+			},
+		},
+		{
+			name:      "ipv6 nested",
+			recs:      []string{"S A 2001:db8::/32", "S B 2001:db8:1::/48"},
+			conflicts: 1,
+			want: map[string]string{
+				ConflictPolicyReport:       "S/A 2001:db8::-2001:db8:ffff:ffff:ffff:ffff:ffff:ffff S/B 2001:db8:1::-2001:db8:1:ffff:ffff:ffff:ffff:ffff",
+				ConflictPolicyFail:         failed,
+				ConflictPolicyMostSpecific: "S/A 2001:db8::-2001:db8:0:ffff:ffff:ffff:ffff:ffff,2001:db8:2::-2001:db8:ffff:ffff:ffff:ffff:ffff:ffff S/B 2001:db8:1::-2001:db8:1:ffff:ffff:ffff:ffff:ffff",
+				ConflictPolicyFirst:        "S/A 2001:db8::-2001:db8:ffff:ffff:ffff:ffff:ffff:ffff",
+			},
+		},
+		{
+			// an IPv4 block is not in an IPv6 block of the same leading bits
+			name: "ipv4 and ipv6",
+			recs: []string{"S A 0.0.0.0/0", "S B ::/0", "S C 10.0.0.0/8", "S D ::/8"},
+			// 10.0.0.0/8 in 0.0.0.0/0, ::/8 in ::/0
+			conflicts: 2,
+			want: map[string]string{
+				ConflictPolicyReport:       "S/A 0.0.0.0-255.255.255.255 S/B ::-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff S/C 10.0.0.0-10.255.255.255 S/D ::-ff:ffff:ffff:ffff:ffff:ffff:ffff:ffff",
+				ConflictPolicyFail:         failed,
+				ConflictPolicyMostSpecific: "S/A 0.0.0.0-9.255.255.255,11.0.0.0-255.255.255.255 S/B 100::-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff S/C 10.0.0.0-10.255.255.255 S/D ::-ff:ffff:ffff:ffff:ffff:ffff:ffff:ffff",
+				ConflictPolicyFirst:        "S/A 0.0.0.0-255.255.255.255 S/B ::-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff",
+			},
+		},
+		{
+			name:      "ipv4 and ipv6 only",
+			recs:      []string{"S A 0.0.0.0/0", "S B ::/0"},
+			conflicts: 0,
+			want: map[string]string{
+				ConflictPolicyFail:         "S/A 0.0.0.0-255.255.255.255 S/B ::-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff",
+				ConflictPolicyMostSpecific: "S/A 0.0.0.0-255.255.255.255 S/B ::-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff",
+			},
+		},
+		{
+			name:      "same glbId and other serviceCode",
+			recs:      []string{"S A 10.0.0.0/16", "S A 10.0.1.0/24", "T B 10.0.2.0/24"},
+			conflicts: 0,
+			want: map[string]string{
+				ConflictPolicyFail:  "S/A 10.0.0.0-10.0.255.255 T/B 10.0.2.0-10.0.2.255",
+				ConflictPolicyFirst: "S/A 10.0.0.0-10.0.255.255 T/B 10.0.2.0-10.0.2.255",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FindConflicts(testRangeRecords(t, tt.recs)); len(got) != tt.conflicts {
+				t.Errorf("conflicts %v, want %d", got, tt.conflicts)
+			}
+			for policy, want := range tt.want {
+				recs := testRangeRecords(t, tt.recs)
+				resolved, err := ResolveConflicts(recs, policy)
+				if want == failed {
+					if err == nil {
+						t.Errorf("policy[%s], %s, want an error", policy, glbCoverage(resolved))
+					}
+					continue
+				}
+				if err != nil {
+					t.Errorf("policy[%s], %v", policy, err)
+					continue
+				}
+				if got := glbCoverage(resolved); got != want {
+					t.Errorf("policy[%s]\n got %s\nwant %s", policy, got, want)
+				}
+				// the split records keep the line of their input
+				for _, rec := range resolved {
+					if rec.Line == 0 {
+						t.Errorf("policy[%s], %v, no line", policy, rec.CIDR)
+					}
+				}
+			}
+		})
+	}
+
+	if _, err := ResolveConflicts(testRangeRecords(t, []string{"S A 10.0.0.0/16", "S B 10.0.1.0/24"}), "last"); err == nil {
+		t.Errorf("policy[last], want an invalid conflict policy error")
+	}
+}
@@ -0,0 +1,181 @@
+package ipms
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// InputSchema : columns of a delimited input file
+// column numbers start from 1, 0 means the column does not exist
+// a range is StartIP and EndIP, or StartIP and Prefix
+type InputSchema struct {
+	Delimiter    string         `yaml:"delimiter"`
+	Columns      int            `yaml:"columns"`
+	ExtraColumns bool           `yaml:"allow-extra-columns"`
+	HeaderLines  int            `yaml:"header-lines"`
+	StartIP      int            `yaml:"start-ip"`
+	EndIP        int            `yaml:"end-ip"`
+	Prefix       int            `yaml:"prefix"`
+	OfficeCode   int            `yaml:"office-code"`
+	NetCode      int            `yaml:"net-code"`
+	Fields       map[string]int `yaml:"fields"`
+}
+
+func (s *InputSchema) validate() error {
+	if s.Delimiter == "" {
+		return errors.New("delimiter not exist")
+	}
+	if s.Columns <= 0 {
+		return errors.New("columns not exist")
+	}
+	if s.HeaderLines < 0 {
+		return fmt.Errorf("invalid header-lines[%d]", s.HeaderLines)
+	}
+	if s.StartIP == 0 {
+		return errors.New("start-ip not exist")
+	}
+	if (s.EndIP == 0) == (s.Prefix == 0) {
+		return errors.New("one of end-ip and prefix must exist")
+	}
+	cols := map[string]int{
+		"start-ip":    s.StartIP,
+		"end-ip":      s.EndIP,
+		"prefix":      s.Prefix,
+		"office-code": s.OfficeCode,
+		"net-code":    s.NetCode,
+	}
+	for name, n := range s.Fields {
+		cols["fields."+name] = n
+	}
+	for name, n := range cols {
+		if n < 0 || n > s.Columns {
+			return fmt.Errorf("invalid %s[%d], columns[%d]", name, n, s.Columns)
+		}
+	}
+	return nil
+}
+
+// ipmsV1Schema : StartIP|NETCODE|...|IPMS_OFC_CD|...|Prefix
+var ipmsV1Schema = InputSchema{
+	Delimiter:    "|",
+	Columns:      8,
+	ExtraColumns: true,
+	StartIP:      1,
+	NetCode:      2,
+	OfficeCode:   6,
+	Prefix:       8,
+}
+
+// ipmsV2Schema : StartIP|EndIP|Beallorg|IPMS_OFC_CD|IPMS_OFC_NAME|pubpri|NETCODE|Assrole
+var ipmsV2Schema = InputSchema{
+	Delimiter:  "|",
+	Columns:    8,
+	StartIP:    1,
+	EndIP:      2,
+	OfficeCode: 4,
+	NetCode:    7,
+	Fields: map[string]int{
+		FieldBeallorg:   3,
+		FieldOfficeName: 5,
+		FieldPubpri:     6,
+		FieldAssrole:    8,
+	},
+}
+
+func init() {
+	RegisterSource("ipms-v1", func(filename string, cfg *YmlConfig) (Source, error) {
+		return newDelimitedSource(filename, ipmsV1Schema, cfg)
+	})
+	RegisterSource("ipms-v2", func(filename string, cfg *YmlConfig) (Source, error) {
+		return newDelimitedSource(filename, ipmsV2Schema, cfg)
+	})
+	// columns given by input-schema of the config
+	RegisterSource("delimited", func(filename string, cfg *YmlConfig) (Source, error) {
+		if cfg == nil || cfg.InputSchema == nil {
+			return nil, errors.New("input-schema not exist")
+		}
+		return newDelimitedSource(filename, *cfg.InputSchema, cfg)
+	})
+	RegisterSourceFields("ipms-v1", func(*YmlConfig) []string { return schemaFields(&ipmsV1Schema) })
+	RegisterSourceFields("ipms-v2", func(*YmlConfig) []string { return schemaFields(&ipmsV2Schema) })
+	RegisterSourceFields("delimited", func(cfg *YmlConfig) []string {
+		if cfg == nil {
+			return nil
+		}
+		return schemaFields(cfg.InputSchema)
+	})
+}
+
+type delimitedSource struct {
+	f      io.ReadCloser
+	s      *bufio.Scanner
+	schema InputSchema
+	decode lineDecoder
+	line   int
+}
+
+func newDelimitedSource(filename string, schema InputSchema, cfg *YmlConfig) (*delimitedSource, error) {
+	decode, err := newLineDecoder(inputEncoding(cfg))
+	if err != nil {
+		return nil, err
+	}
+	f, err := OpenInput(filename, inputArchiveEntry(cfg))
+	if err != nil {
+		return nil, err
+	}
+	return &delimitedSource{f: f, s: bufio.NewScanner(f), schema: schema, decode: decode}, nil
+}
+
+// Next :
+func (src *delimitedSource) Next() (*RangeRow, error) {
+	for {
+		if !src.s.Scan() {
+			if err := src.s.Err(); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+		src.line++
+		// skip header
+		if src.line > src.schema.HeaderLines {
+			break
+		}
+	}
+	line, err := src.decode(src.s.Bytes())
+	if err != nil {
+		return &RangeRow{Line: src.line, Raw: src.s.Text(), Invalid: fmt.Sprintf("encoding, %v", err)}, nil
+	}
+	row := &RangeRow{Line: src.line, Raw: line}
+
+	l := &src.schema
+	ret := strings.Split(line, l.Delimiter)
+	if len(ret) < l.Columns || (!l.ExtraColumns && len(ret) != l.Columns) {
+		row.Invalid = fmt.Sprintf("field count[%d]", len(ret))
+		return row, nil
+	}
+	col := func(n int) string {
+		if n <= 0 {
+			return ""
+		}
+		return ret[n-1]
+	}
+
+	row.StartIP = strings.TrimSpace(col(l.StartIP))
+	row.EndIP = strings.TrimSpace(col(l.EndIP))
+	row.Prefix = strings.TrimSpace(col(l.Prefix))
+	row.OfficeCode = col(l.OfficeCode)
+	row.NetCode = col(l.NetCode)
+	row.Fields = map[string]string{}
+	for name, n := range l.Fields {
+		row.Fields[name] = col(n)
+	}
+	return row, nil
+}
+
+// Close :
+func (src *delimitedSource) Close() error {
+	return src.f.Close()
+}
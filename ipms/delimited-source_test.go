@@ -0,0 +1,183 @@
+package ipms
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readRows : "line start|end|prefix|officeCode|netCode|officeName" of each row of the source,
+// or "line invalid[reason]"
+func readRows(src Source) ([]string, error) {
+	var rows []string
+	for {
+		row, err := src.Next()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return rows, err
+		}
+		if row.Invalid != "" {
+			rows = append(rows, fmt.Sprintf("%d invalid[%s]", row.Line, row.Invalid))
+			continue
+		}
+		rows = append(rows, fmt.Sprintf("%d %s|%s|%s|%s|%s|%s", row.Line, row.StartIP, row.EndIP, row.Prefix, row.OfficeCode, row.NetCode, row.Fields[FieldOfficeName]))
+	}
+}
+
+func TestDelimitedSource(t *testing.T) {
+	// 양재 in EUC-KR
+	eucKR := "\xbe\xe7\xc0\xe7"
+	schema := &InputSchema{Delimiter: ",", Columns: 4, HeaderLines: 1, StartIP: 2, Prefix: 3, OfficeCode: 1, Fields: map[string]int{FieldOfficeName: 4}}
+	tests := []struct {
+		name     string
+		format   string
+		encoding string
+		content  string
+		want     []string
+		wantErr  string // error of the open, empty when it opens
+	}{
+		{
+			name:    "ipms-v2",
+			format:  "ipms-v2",
+			content: "10.0.0.0|10.0.0.255|a|R00001|양재|공인|00|x\n 10.0.1.0 | 10.0.1.127 |a|R00002|b|공인|01|x\n",
+			want:    []string{"1 10.0.0.0|10.0.0.255||R00001|00|양재", "2 10.0.1.0|10.0.1.127||R00002|01|b"},
+		},
+		{
+			name:    "ipms-v2 missing and extra columns",
+			format:  "ipms-v2",
+			content: "10.0.0.0|10.0.0.255|a|R00001|a|x|00\n10.0.0.0|10.0.0.255|a|R00001|a|x|00|x|y\n\n",
+			want:    []string{"1 invalid[field count[7]]", "2 invalid[field count[9]]", "3 invalid[field count[1]]"},
+		},
+		{
+			name:    "ipms-v1 allows extra columns",
+			format:  "ipms-v1",
+			content: "10.0.0.0|00|a|a|a|R00001|a|24|x\n10.0.1.0|00|a|a|a|R00001|a\n",
+			want:    []string{"1 10.0.0.0||24|R00001|00|", "2 invalid[field count[7]]"},
+		},
+		{
+			name:    "empty file",
+			format:  "ipms-v2",
+			content: "",
+		},
+		{
+			name:    "utf-8 bom",
+			format:  "ipms-v2",
+			content: "\ufeff10.0.0.0|10.0.0.255|a|R00001|a|x|00|x\n",
+			want:    []string{"1 10.0.0.0|10.0.0.255||R00001|00|a"},
+		},
+		{
+			name:     "euc-kr by auto",
+			format:   "ipms-v2",
+			encoding: EncodingAuto,
+			content:  "10.0.0.0|10.0.0.255|a|R00001|" + eucKR + "|x|00|x\n10.0.1.0|10.0.1.255|a|R00001|양재|x|00|x\n",
+			want:     []string{"1 10.0.0.0|10.0.0.255||R00001|00|양재", "2 10.0.1.0|10.0.1.255||R00001|00|양재"},
+		},
+		{
+			name:     "euc-kr",
+			format:   "ipms-v2",
+			encoding: EncodingEUCKR,
+			content:  "10.0.0.0|10.0.0.255|a|R00001|" + eucKR + "|x|00|x\n",
+			want:     []string{"1 10.0.0.0|10.0.0.255||R00001|00|양재"},
+		},
+		{
+			name:     "euc-kr as utf-8",
+			format:   "ipms-v2",
+			encoding: EncodingUTF8,
+			content:  "10.0.0.0|10.0.0.255|a|R00001|" + eucKR + "|x|00|x\n10.0.1.0|10.0.1.255|a|R00001|a|x|00|x\n",
+			want:     []string{"1 invalid[encoding, invalid utf-8]", "2 10.0.1.0|10.0.1.255||R00001|00|a"},
+		},
+		{
+			name:     "bad euc-kr",
+			format:   "ipms-v2",
+			encoding: EncodingAuto,
+			content:  "10.0.0.0|10.0.0.255|a|R00001|\xff\xfe|x|00|x\n",
+			want:     []string{"1 invalid[encoding, invalid cp949]"},
+		},
+		{
+			name:     "unknown encoding",
+			format:   "ipms-v2",
+			encoding: "latin-1",
+			wantErr:  "unknown encoding, latin-1",
+		},
+		{
+			name:    "delimited header and prefix",
+			format:  "delimited",
+			content: "office,ip,prefix,name\nR00001,10.0.0.0,24,a\nR00002,10.0.1.0,25\n",
+			want:    []string{"2 10.0.0.0||24|R00001||a", "3 invalid[field count[3]]"},
+		},
+		{
+			name:    "delimited header only",
+			format:  "delimited",
+			content: "office,ip,prefix,name\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeTestFiles(t, map[string]string{"in.csv": tt.content})
+			cfg := &YmlConfig{InputEncoding: tt.encoding, InputSchema: schema}
+			src, err := OpenSource(tt.format, filepath.Join(dir, "in.csv"), cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer src.Close()
+			got, err := readRows(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("rows\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+
+	dir := writeTestFiles(t, map[string]string{"in.csv": ""})
+	if _, err := OpenSource("delimited", filepath.Join(dir, "in.csv"), &YmlConfig{}); err == nil || !strings.Contains(err.Error(), "input-schema not exist") {
+		t.Errorf("delimited without input-schema, err %v", err)
+	}
+	if _, err := OpenSource("ipms-v2", filepath.Join(dir, "none.csv"), &YmlConfig{}); err == nil {
+		t.Errorf("missing file, want an error")
+	}
+}
+
+func TestInputSchemaValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  InputSchema
+		wantErr string // empty when the schema is valid
+	}{
+		{"ipms-v2", ipmsV2Schema, ""},
+		{"ipms-v1", ipmsV1Schema, ""},
+		{"no delimiter", InputSchema{Columns: 2, StartIP: 1, Prefix: 2}, "delimiter not exist"},
+		{"no columns", InputSchema{Delimiter: ",", StartIP: 1, Prefix: 2}, "columns not exist"},
+		{"negative header-lines", InputSchema{Delimiter: ",", Columns: 2, HeaderLines: -1, StartIP: 1, Prefix: 2}, "invalid header-lines[-1]"},
+		{"no start-ip", InputSchema{Delimiter: ",", Columns: 2, Prefix: 2}, "start-ip not exist"},
+		{"end-ip and prefix", InputSchema{Delimiter: ",", Columns: 3, StartIP: 1, EndIP: 2, Prefix: 3}, "one of end-ip and prefix"},
+		{"neither end-ip nor prefix", InputSchema{Delimiter: ",", Columns: 3, StartIP: 1}, "one of end-ip and prefix"},
+		{"column out of columns", InputSchema{Delimiter: ",", Columns: 2, StartIP: 1, Prefix: 2, OfficeCode: 3}, "invalid office-code[3], columns[2]"},
+		{"field out of columns", InputSchema{Delimiter: ",", Columns: 2, StartIP: 1, Prefix: 2, Fields: map[string]int{"x": 5}}, "invalid fields.x[5], columns[2]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.schema.validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Error(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package ipms
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/castisdev/cilog"
+)
+
+// import modes
+const (
+	ImportModeFull  = "full"
+	ImportModeDelta = "delta"
+)
+
+// GLBDelta : netMasks added to and removed from a glbId since the last import
+type GLBDelta struct {
+	GLBID   string         `json:"glbId"`
+	Added   []*NetMaskInfo `json:"addedNetMaskAddressList"`
+	Removed []*NetMaskInfo `json:"removedNetMaskAddressList"`
+}
+
+// ServiceCodeDelta :
+type ServiceCodeDelta struct {
+	ServiceCode    string      `json:"serviceCode"`
+	GLBIDDeltaList []*GLBDelta `json:"glbIdDeltaList"`
+}
+
+type glbKey struct {
+	serviceCode string
+	glbID       string
+}
+
+func netMaskSet(infos []*ServiceCodeInfo) map[glbKey]map[NetMaskInfo]struct{} {
+	set := map[glbKey]map[NetMaskInfo]struct{}{}
+	for _, sc := range infos {
+		for _, glb := range sc.GLBIDNetMaskList {
+			k := glbKey{sc.ServiceCode, glb.GLBID}
+			if set[k] == nil {
+				set[k] = map[NetMaskInfo]struct{}{}
+			}
+			for _, n := range glb.NetMaskAddressList {
+				set[k][*n] = struct{}{}
+			}
+		}
+	}
+	return set
+}
+
+func missingNetMasks(from, in map[NetMaskInfo]struct{}) []*NetMaskInfo {
+	l := []*NetMaskInfo{}
+	for n := range from {
+		if _, ok := in[n]; !ok {
+			n := n
+			l = append(l, &n)
+		}
+	}
+	sort.Slice(l, func(i, j int) bool {
+		if l[i].NetMaskAddress != l[j].NetMaskAddress {
+			return l[i].NetMaskAddress < l[j].NetMaskAddress
+		}
+		return l[i].NetCode < l[j].NetCode
+	})
+	return l
+}
+
+// ComputeDelta : netMask entries added and removed per serviceCode and glbId from prev to cur
+func ComputeDelta(prev, cur []*ServiceCodeInfo) []*ServiceCodeDelta {
+	prevSet := netMaskSet(prev)
+	curSet := netMaskSet(cur)
+
+	var keys []glbKey
+	for k := range prevSet {
+		keys = append(keys, k)
+	}
+	for k := range curSet {
+		if _, ok := prevSet[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].serviceCode != keys[j].serviceCode {
+			return keys[i].serviceCode < keys[j].serviceCode
+		}
+		return keys[i].glbID < keys[j].glbID
+	})
+
+	var deltas []*ServiceCodeDelta
+	var scDelta *ServiceCodeDelta
+	for _, k := range keys {
+		d := &GLBDelta{
+			GLBID:   k.glbID,
+			Added:   missingNetMasks(curSet[k], prevSet[k]),
+			Removed: missingNetMasks(prevSet[k], curSet[k]),
+		}
+		if len(d.Added) == 0 && len(d.Removed) == 0 {
+			continue
+		}
+		if scDelta == nil || scDelta.ServiceCode != k.serviceCode {
+			scDelta = &ServiceCodeDelta{ServiceCode: k.serviceCode}
+			deltas = append(deltas, scDelta)
+		}
+		scDelta.GLBIDDeltaList = append(scDelta.GLBIDDeltaList, d)
+	}
+	return deltas
+}
+
+// LoadServiceCodeInfos :
+func LoadServiceCodeInfos(filename string) ([]*ServiceCodeInfo, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var infos []*ServiceCodeInfo
+	err = json.Unmarshal(b, &infos)
+	if err != nil {
+		return nil, err
+	}
+	return infos, nil
+}
+
+// SaveServiceCodeInfos : writes to a temporary file and renames it, so a failed write keeps the old file
+func SaveServiceCodeInfos(filename string, infos []*ServiceCodeInfo) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+		return err
+	}
+	b, err := json.Marshal(infos)
+	if err != nil {
+		return err
+	}
+	tmp := filename + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+// ImportIPMSRecords : posts infos in the configured import mode, and saves them as the last import
+func ImportIPMSRecords(cfg *YmlConfig, infos []*ServiceCodeInfo) error {
+	api, body, err := importPayload(cfg, infos)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		client, err := cfg.Client()
+		if err != nil {
+			return err
+		}
+		if err := client.PostJSON(api, body); err != nil {
+			return err
+		}
+	}
+
+	if cfg.LastImportFile != "" {
+		if err := SaveServiceCodeInfos(cfg.LastImportFile, infos); err != nil {
+			return fmt.Errorf("posted, but failed to save last import, %s, %v", cfg.LastImportFile, err)
+		}
+	}
+	return nil
+}
+
+// importPayload : the api and the body to post for infos, body is nil when there is nothing to post
+// delta mode posts the full records when there is no last import
+func importPayload(cfg *YmlConfig, infos []*ServiceCodeInfo) (string, interface{}, error) {
+	if cfg.ImportMode != ImportModeDelta {
+		return cfg.IPRoutingInfoCfgAPI, infos, nil
+	}
+
+	prev, err := LoadServiceCodeInfos(cfg.LastImportFile)
+	if os.IsNotExist(err) {
+		cilog.Warningf("last import not exist, %s, post full records", cfg.LastImportFile)
+		return cfg.IPRoutingInfoCfgAPI, infos, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	deltas := ComputeDelta(prev, infos)
+	added, removed := 0, 0
+	for _, sc := range deltas {
+		for _, d := range sc.GLBIDDeltaList {
+			added += len(d.Added)
+			removed += len(d.Removed)
+		}
+	}
+	cilog.Infof("delta from last import, added[%d], removed[%d]", added, removed)
+	if len(deltas) == 0 {
+		cilog.Infof("no change from last import, skip post")
+		return cfg.IPMSDeltaAPI, nil, nil
+	}
+	return cfg.IPMSDeltaAPI, deltas, nil
+}
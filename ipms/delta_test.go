@@ -0,0 +1,128 @@
+package ipms
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func deltaString(deltas []*ServiceCodeDelta) string {
+	var l []string
+	for _, sc := range deltas {
+		for _, d := range sc.GLBIDDeltaList {
+			var added, removed []string
+			for _, n := range d.Added {
+				added = append(added, n.NetMaskAddress+"/"+n.NetCode)
+			}
+			for _, n := range d.Removed {
+				removed = append(removed, n.NetMaskAddress+"/"+n.NetCode)
+			}
+			l = append(l, fmt.Sprintf("%s/%s +%v -%v", sc.ServiceCode, d.GLBID, added, removed))
+		}
+	}
+	return strings.Join(l, " ")
+}
+
+func TestComputeDelta(t *testing.T) {
+	tests := []struct {
+		name      string
+		prev, cur []string
+		want      string
+	}{
+		{
+			name: "no change",
+			prev: []string{"S A 00 10.0.0.0/24", "S B 00 10.0.1.0/24"},
+			cur:  []string{"S B 00 10.0.1.0/24", "S A 00 10.0.0.0/24"},
+		},
+		{
+			name: "added and removed",
+			prev: []string{"S A 00 10.0.0.0/24", "S A 00 10.0.1.0/24"},
+			cur:  []string{"S A 00 10.0.0.0/24", "S A 00 10.0.2.0/24"},
+			want: "S/A +[10.0.2.0/24/00] -[10.0.1.0/24/00]",
+		},
+		{
+			// the same netMask of another netCode is removed and added
+			name: "netCode changed",
+			prev: []string{"S A 00 10.0.0.0/24"},
+			cur:  []string{"S A 01 10.0.0.0/24"},
+			want: "S/A +[10.0.0.0/24/01] -[10.0.0.0/24/00]",
+		},
+		{
+			name: "moved to another glbId",
+			prev: []string{"S A 00 10.0.0.0/24"},
+			cur:  []string{"S B 00 10.0.0.0/24"},
+			want: "S/A +[] -[10.0.0.0/24/00] S/B +[10.0.0.0/24/00] -[]",
+		},
+		{
+			name: "new and gone serviceCodes, sorted",
+			prev: []string{"U A 00 10.0.0.0/24", "S A 00 2001:db8::/32"},
+			cur:  []string{"T A 00 10.0.0.0/24", "S A 00 2001:db8::/32", "S A 00 10.0.1.0/24", "S A 00 10.0.0.0/24"},
+			want: "S/A +[10.0.0.0/24/00 10.0.1.0/24/00] -[] T/A +[10.0.0.0/24/00] -[] U/A +[] -[10.0.0.0/24/00]",
+		},
+		{
+			name: "no last import",
+			cur:  []string{"S A 00 10.0.0.0/24"},
+			want: "S/A +[10.0.0.0/24/00] -[]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := deltaString(ComputeDelta(testInfos(tt.prev), testInfos(tt.cur))); got != tt.want {
+				t.Errorf("delta %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportPayload(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &YmlConfig{
+		IPRoutingInfoCfgAPI: "http://full",
+		IPMSDeltaAPI:        "http://delta",
+		ImportMode:          ImportModeDelta,
+		LastImportFile:      filepath.Join(dir, "last", "import.json"),
+	}
+	infos := testInfos([]string{"S A 00 10.0.0.0/24"})
+
+	// no last import posts the full records
+	api, body, err := importPayload(cfg, infos)
+	if err != nil || api != cfg.IPRoutingInfoCfgAPI || body == nil {
+		t.Errorf("api %s, body %v, err %v, want full records", api, body, err)
+	}
+
+	if err := SaveServiceCodeInfos(cfg.LastImportFile, infos); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(cfg.LastImportFile + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left, %v", err)
+	}
+	api, body, err = importPayload(cfg, infos)
+	if err != nil || api != cfg.IPMSDeltaAPI || body != nil {
+		t.Errorf("api %s, body %v, err %v, want nothing to post", api, body, err)
+	}
+
+	cur := testInfos([]string{"S A 00 10.0.1.0/24"})
+	api, body, err = importPayload(cfg, cur)
+	if err != nil || api != cfg.IPMSDeltaAPI {
+		t.Fatalf("api %s, err %v, want the delta api", api, err)
+	}
+	if got := deltaString(body.([]*ServiceCodeDelta)); got != "S/A +[10.0.1.0/24/00] -[10.0.0.0/24/00]" {
+		t.Errorf("delta %s", got)
+	}
+
+	cfg.ImportMode = ImportModeFull
+	if api, _, _ := importPayload(cfg, cur); api != cfg.IPRoutingInfoCfgAPI {
+		t.Errorf("full mode, api %s", api)
+	}
+
+	cfg.ImportMode = ImportModeDelta
+	if err := ioutil.WriteFile(cfg.LastImportFile, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := importPayload(cfg, cur); err == nil {
+		t.Errorf("broken last import, want an error")
+	}
+}
@@ -0,0 +1,152 @@
+package ipms
+
+import (
+	"fmt"
+	"net"
+	"sort"
+)
+
+// diff kinds
+const (
+	DiffAdded      = "added"
+	DiffRemoved    = "removed"
+	DiffReassigned = "reassigned"
+)
+
+// DiffEntry : change of a netMask between two ipms snapshots
+// PrevGLBID, PrevNetCode are empty for added, GLBID, NetCode are empty for removed
+type DiffEntry struct {
+	Kind        string
+	ServiceCode string
+	CIDR        string
+	IPNet       *net.IPNet
+	PrevGLBID   string
+	PrevNetCode string
+	GLBID       string
+	NetCode     string
+}
+
+func (e *DiffEntry) String() string {
+	switch e.Kind {
+	case DiffAdded:
+		return fmt.Sprintf("%s, serviceCode[%s], netMask[%s], glbId[%s], netCode[%s]", e.Kind, e.ServiceCode, e.CIDR, e.GLBID, e.NetCode)
+	case DiffRemoved:
+		return fmt.Sprintf("%s, serviceCode[%s], netMask[%s], glbId[%s], netCode[%s]", e.Kind, e.ServiceCode, e.CIDR, e.PrevGLBID, e.PrevNetCode)
+	}
+	return fmt.Sprintf("%s, serviceCode[%s], netMask[%s], glbId[%s] -> [%s], netCode[%s] -> [%s]", e.Kind, e.ServiceCode, e.CIDR, e.PrevGLBID, e.GLBID, e.PrevNetCode, e.NetCode)
+}
+
+// glbID : the glbId the entry is reported under
+func (e *DiffEntry) glbID() string {
+	if e.Kind == DiffRemoved {
+		return e.PrevGLBID
+	}
+	return e.GLBID
+}
+
+type diffSort []*DiffEntry
+
+func (s diffSort) Len() int {
+	return len(s)
+}
+func (s diffSort) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s diffSort) Less(i, j int) bool {
+	if s[i].ServiceCode != s[j].ServiceCode {
+		return s[i].ServiceCode < s[j].ServiceCode
+	}
+	if s[i].glbID() != s[j].glbID() {
+		return s[i].glbID() < s[j].glbID()
+	}
+	return cmp(normalizeIP(s[i].IPNet.IP), normalizeIP(s[j].IPNet.IP)) < 0
+}
+
+type routeKey struct {
+	glbID   string
+	netCode string
+}
+
+func groupRanges(recs []*IpmsRecord) map[string]map[routeKey][]IPRange {
+	groups := map[string]map[routeKey][]IPRange{}
+	for _, rec := range recs {
+		if groups[rec.ServiceCode] == nil {
+			groups[rec.ServiceCode] = map[routeKey][]IPRange{}
+		}
+		k := routeKey{rec.GLBID, rec.NetCode}
+		groups[rec.ServiceCode][k] = append(groups[rec.ServiceCode][k], rec.Range())
+	}
+	for _, g := range groups {
+		for k, rs := range g {
+			g[k] = mergeRanges(rs)
+		}
+	}
+	return groups
+}
+
+func unionRanges(g map[routeKey][]IPRange) []IPRange {
+	var all []IPRange
+	for _, rs := range g {
+		all = append(all, rs...)
+	}
+	return mergeRanges(all)
+}
+
+// intersectRanges : a and b must be merged by mergeRanges
+func intersectRanges(a, b []IPRange) []IPRange {
+	return subtractRanges(a, subtractRanges(a, b))
+}
+
+// DiffIPMSRecords : added, removed and reassigned netMasks from prev to cur per serviceCode
+func DiffIPMSRecords(prev, cur []*IpmsRecord) []*DiffEntry {
+	prevGroups := groupRanges(prev)
+	curGroups := groupRanges(cur)
+
+	var entries []*DiffEntry
+	add := func(kind, serviceCode string, rs []IPRange, from, to routeKey) {
+		for _, r := range rs {
+			for _, cidr := range r.CIDRs() {
+				entries = append(entries, &DiffEntry{
+					Kind:        kind,
+					ServiceCode: serviceCode,
+					CIDR:        cidr.String(),
+					IPNet:       cidr,
+					PrevGLBID:   from.glbID,
+					PrevNetCode: from.netCode,
+					GLBID:       to.glbID,
+					NetCode:     to.netCode,
+				})
+			}
+		}
+	}
+
+	serviceCodes := map[string]struct{}{}
+	for sc := range prevGroups {
+		serviceCodes[sc] = struct{}{}
+	}
+	for sc := range curGroups {
+		serviceCodes[sc] = struct{}{}
+	}
+
+	for sc := range serviceCodes {
+		p, c := prevGroups[sc], curGroups[sc]
+		prevAll, curAll := unionRanges(p), unionRanges(c)
+		for k, rs := range c {
+			add(DiffAdded, sc, subtractRanges(rs, prevAll), routeKey{}, k)
+		}
+		for k, rs := range p {
+			add(DiffRemoved, sc, subtractRanges(rs, curAll), k, routeKey{})
+		}
+		for pk, prs := range p {
+			for ck, crs := range c {
+				if pk == ck {
+					continue
+				}
+				// an address still routed to pk, or already routed to ck before, is not reassigned
+				add(DiffReassigned, sc, intersectRanges(subtractRanges(prs, c[pk]), subtractRanges(crs, p[ck])), pk, ck)
+			}
+		}
+	}
+	sort.Sort(diffSort(entries))
+	return entries
+}
@@ -0,0 +1,60 @@
+package ipms
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestDiffIPMSRecords(t *testing.T) {
+	tests := []struct {
+		name string
+		prev []string // serviceCode glbId netCode cidr
+		cur  []string
+		want []string // kind cidr prevGlbId glbId
+	}{
+		{
+			name: "reassigned",
+			prev: []string{"S A 00 10.0.0.0/24"},
+			cur:  []string{"S B 00 10.0.0.0/24"},
+			want: []string{"reassigned 10.0.0.0/24 A B"},
+		},
+		{
+			name: "added and removed",
+			prev: []string{"S A 00 10.0.0.0/24"},
+			cur:  []string{"S A 00 10.0.1.0/24"},
+			want: []string{"added 10.0.1.0/24  A", "removed 10.0.0.0/24 A "},
+		},
+		{
+			name: "still routed to the previous glbId",
+			prev: []string{"S A 00 10.0.0.0/24"},
+			cur:  []string{"S A 00 10.0.0.0/24", "S B 00 10.0.0.0/24"},
+		},
+		{
+			name: "already routed to the current glbId",
+			prev: []string{"S A 00 10.0.0.0/24", "S B 00 10.0.0.0/24"},
+			cur:  []string{"S B 00 10.0.0.0/24"},
+		},
+		{
+			name: "partially reassigned",
+			prev: []string{"S A 00 10.0.0.0/23", "S B 00 10.0.0.0/24"},
+			cur:  []string{"S B 00 10.0.0.0/23"},
+			want: []string{"reassigned 10.0.1.0/24 A B"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, e := range DiffIPMSRecords(testRecords(t, tt.prev), testRecords(t, tt.cur)) {
+				got = append(got, strings.Join([]string{e.Kind, e.CIDR, e.PrevGLBID, e.GLBID}, " "))
+			}
+			sort.Strings(got)
+			want := append([]string{}, tt.want...)
+			sort.Strings(want)
+			if strings.Join(got, "|") != strings.Join(want, "|") {
+				t.Errorf("diff %q, want %q", got, want)
+			}
+		})
+	}
+}
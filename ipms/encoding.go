@@ -0,0 +1,68 @@
+package ipms
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/korean"
+)
+
+// input encodings, auto decodes a line as cp949 when it is not valid utf-8
+const (
+	EncodingAuto  = "auto"
+	EncodingUTF8  = "utf-8"
+	EncodingEUCKR = "euc-kr"
+	EncodingCP949 = "cp949"
+)
+
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// lineDecoder : converts a line to utf-8
+type lineDecoder func(b []byte) (string, error)
+
+func decodeCP949(b []byte) (string, error) {
+	// x/text EUCKR decodes the cp949 extension too
+	out, err := korean.EUCKR.NewDecoder().Bytes(b)
+	if err != nil {
+		return "", err
+	}
+	// the decoder replaces invalid bytes with U+FFFD instead of failing
+	if bytes.ContainsRune(out, utf8.RuneError) {
+		return "", errors.New("invalid cp949")
+	}
+	return string(out), nil
+}
+
+func decodeUTF8(b []byte) (string, error) {
+	if !utf8.Valid(b) {
+		return "", errors.New("invalid utf-8")
+	}
+	return string(bytes.TrimPrefix(b, utf8BOM)), nil
+}
+
+func newLineDecoder(encoding string) (lineDecoder, error) {
+	switch strings.ToLower(encoding) {
+	case "", EncodingAuto:
+		return func(b []byte) (string, error) {
+			if utf8.Valid(b) {
+				return decodeUTF8(b)
+			}
+			return decodeCP949(b)
+		}, nil
+	case EncodingUTF8, "utf8":
+		return decodeUTF8, nil
+	case EncodingEUCKR, EncodingCP949, "euckr", "ms949", "uhc":
+		return decodeCP949, nil
+	}
+	return nil, fmt.Errorf("unknown encoding, %s", encoding)
+}
+
+func inputEncoding(cfg *YmlConfig) string {
+	if cfg == nil {
+		return EncodingAuto
+	}
+	return cfg.InputEncoding
+}
@@ -0,0 +1,191 @@
+package ipms
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// filter actions
+const (
+	FilterInclude = "include"
+	FilterExclude = "exclude"
+)
+
+// filter fields besides the descriptive fields of a RangeRow
+const (
+	FilterFieldOfficeCode = "office-code"
+	FilterFieldNetCode    = "net-code"
+)
+
+// FilterRule : keeps (include) or drops (exclude) the rows whose Field matches
+// one of Value, Values or Regex must be given, Regex must match the whole value
+type FilterRule struct {
+	Name   string   `yaml:"name"`
+	Field  string   `yaml:"field"`
+	Action string   `yaml:"action"`
+	Value  string   `yaml:"value"`
+	Values []string `yaml:"values"`
+	Regex  string   `yaml:"regex"`
+
+	re *regexp.Regexp
+}
+
+// filterFields : fields a rule can use, of format when it is registered,
+// or else office-code, net-code, the descriptive fields of ipms-v2 and the fields of input-schema of cfg
+func filterFields(format string, cfg *YmlConfig) []string {
+	if fields, ok := formatFields(format, cfg); ok {
+		return fields
+	}
+	fields := []string{FilterFieldOfficeCode, FilterFieldNetCode}
+	for name := range ipmsV2Schema.Fields {
+		fields = append(fields, name)
+	}
+	if cfg.InputSchema != nil {
+		for name := range cfg.InputSchema.Fields {
+			if _, ok := ipmsV2Schema.Fields[name]; !ok {
+				fields = append(fields, name)
+			}
+		}
+	}
+	sort.Strings(fields[2:])
+	return fields
+}
+
+// schemaFields : office-code and net-code when schema has their columns, and the fields of schema
+func schemaFields(schema *InputSchema) []string {
+	var fields []string
+	if schema == nil {
+		return fields
+	}
+	if schema.OfficeCode > 0 {
+		fields = append(fields, FilterFieldOfficeCode)
+	}
+	if schema.NetCode > 0 {
+		fields = append(fields, FilterFieldNetCode)
+	}
+	var names []string
+	for name := range schema.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append(fields, names...)
+}
+
+func (r *FilterRule) compile(fields []string) error {
+	if r.Field == "" {
+		return errors.New("field not exist")
+	}
+	known := false
+	for _, f := range fields {
+		if r.Field == f {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return fmt.Errorf("invalid field, %s, must be one of %v", r.Field, fields)
+	}
+	if r.Action != FilterInclude && r.Action != FilterExclude {
+		return fmt.Errorf("invalid action, %s", r.Action)
+	}
+	n := 0
+	if r.Value != "" {
+		n++
+	}
+	if len(r.Values) > 0 {
+		n++
+	}
+	if r.Regex != "" {
+		n++
+		re, err := regexp.Compile("^(?:" + r.Regex + ")$")
+		if err != nil {
+			return fmt.Errorf("invalid regex, %v", err)
+		}
+		r.re = re
+	}
+	if n != 1 {
+		return errors.New("one of value, values and regex must exist")
+	}
+	return nil
+}
+
+// compileFilters : names the rules without name by their order, filter-1, filter-2, ...
+// the fields are checked by input-format of cfg, see filterFields
+func compileFilters(cfg *YmlConfig) error {
+	fields := filterFields(cfg.InputFormat, cfg)
+	names := map[string]struct{}{}
+	for i, r := range cfg.Filters {
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("filter-%d", i+1)
+		}
+		if _, ok := names[r.Name]; ok {
+			return fmt.Errorf("duplicate filter name, %s", r.Name)
+		}
+		names[r.Name] = struct{}{}
+		if err := r.compile(fields); err != nil {
+			return fmt.Errorf("filter[%s], %v", r.Name, err)
+		}
+	}
+	return nil
+}
+
+// sourceFilters : filters of cfg, an error when format does not have the field of a filter,
+// input-format of cfg may be overridden by the command line
+func sourceFilters(format string, cfg *YmlConfig) ([]*FilterRule, error) {
+	if cfg == nil || len(cfg.Filters) == 0 {
+		return nil, nil
+	}
+	fields, _ := formatFields(format, cfg)
+	for _, r := range cfg.Filters {
+		known := false
+		for _, f := range fields {
+			if r.Field == f {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("filter[%s], input format %s has no field %s, fields %v", r.Name, format, r.Field, fields)
+		}
+	}
+	return cfg.Filters, nil
+}
+
+func (r *FilterRule) match(v string) bool {
+	switch {
+	case r.re != nil:
+		return r.re.MatchString(v)
+	case len(r.Values) > 0:
+		for _, s := range r.Values {
+			if v == s {
+				return true
+			}
+		}
+		return false
+	}
+	return v == r.Value
+}
+
+func rowField(row *RangeRow, field string) string {
+	switch field {
+	case FilterFieldOfficeCode:
+		return strings.TrimSpace(row.OfficeCode)
+	case FilterFieldNetCode:
+		return strings.TrimSpace(row.NetCode)
+	}
+	return strings.TrimSpace(row.Fields[field])
+}
+
+// filterRow : the first rule that drops the row, nil when the row is kept
+func filterRow(rules []*FilterRule, row *RangeRow) *FilterRule {
+	for _, r := range rules {
+		m := r.match(rowField(row, r.Field))
+		if (r.Action == FilterInclude && !m) || (r.Action == FilterExclude && m) {
+			return r
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package ipms
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFilterRow(t *testing.T) {
+	row := &RangeRow{OfficeCode: " R00001 ", NetCode: "00", Fields: map[string]string{FieldPubpri: "공인", FieldOfficeName: "양재국사"}}
+	tests := []struct {
+		name string
+		rule FilterRule
+		kept bool
+	}{
+		{"include value", FilterRule{Field: FieldPubpri, Action: FilterInclude, Value: "공인"}, true},
+		{"include other value", FilterRule{Field: FieldPubpri, Action: FilterInclude, Value: "사설"}, false},
+		{"exclude values", FilterRule{Field: FilterFieldNetCode, Action: FilterExclude, Values: []string{"01", "00"}}, false},
+		{"office-code is trimmed", FilterRule{Field: FilterFieldOfficeCode, Action: FilterInclude, Value: "R00001"}, true},
+		{"regex matches the whole value", FilterRule{Field: FieldOfficeName, Action: FilterInclude, Regex: "양재"}, false},
+		{"regex", FilterRule{Field: FieldOfficeName, Action: FilterInclude, Regex: "양재.*"}, true},
+		{"exclude regex", FilterRule{Field: FilterFieldOfficeCode, Action: FilterExclude, Regex: "R0+1"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := tt.rule
+			if err := r.compile(filterFields("ipms-v2", &YmlConfig{})); err != nil {
+				t.Fatal(err)
+			}
+			if kept := filterRow([]*FilterRule{&r}, row) == nil; kept != tt.kept {
+				t.Errorf("kept %v, want %v", kept, tt.kept)
+			}
+		})
+	}
+}
+
+func TestCompileFilters(t *testing.T) {
+	schema := &InputSchema{Delimiter: ",", Columns: 3, StartIP: 1, Prefix: 2, OfficeCode: 3, Fields: map[string]int{"region": 3}}
+	tests := []struct {
+		name    string
+		format  string
+		schema  *InputSchema
+		rule    FilterRule
+		wantErr string // empty when the rule is valid
+	}{
+		{name: "ipms-v2 field", format: "ipms-v2", rule: FilterRule{Field: FieldPubpri, Action: FilterInclude, Value: "공인"}},
+		{name: "ipms-v1 has no pubpri", format: "ipms-v1", rule: FilterRule{Field: FieldPubpri, Action: FilterInclude, Value: "공인"}, wantErr: "invalid field, pubpri"},
+		{name: "ipms-v1 net-code", format: "ipms-v1", rule: FilterRule{Field: FilterFieldNetCode, Action: FilterExclude, Value: "00"}},
+		{name: "delimited field of schema", format: "delimited", schema: schema, rule: FilterRule{Field: "region", Action: FilterInclude, Value: "x"}},
+		{name: "delimited without net-code column", format: "delimited", schema: schema, rule: FilterRule{Field: FilterFieldNetCode, Action: FilterInclude, Value: "00"}, wantErr: "invalid field, net-code"},
+		{name: "no format allows ipms-v2 fields", rule: FilterRule{Field: FieldAssrole, Action: FilterInclude, Value: "x"}},
+		{name: "no format allows input-schema fields", schema: schema, rule: FilterRule{Field: "region", Action: FilterInclude, Value: "x"}},
+		{name: "unknown field", rule: FilterRule{Field: "nothing", Action: FilterInclude, Value: "x"}, wantErr: "invalid field, nothing"},
+		{name: "no field", rule: FilterRule{Action: FilterInclude, Value: "x"}, wantErr: "field not exist"},
+		{name: "invalid action", rule: FilterRule{Field: FilterFieldNetCode, Action: "drop", Value: "x"}, wantErr: "invalid action, drop"},
+		{name: "value and values", rule: FilterRule{Field: FilterFieldNetCode, Action: FilterInclude, Value: "x", Values: []string{"y"}}, wantErr: "one of value, values and regex"},
+		{name: "no value", rule: FilterRule{Field: FilterFieldNetCode, Action: FilterInclude}, wantErr: "one of value, values and regex"},
+		{name: "invalid regex", rule: FilterRule{Field: FilterFieldNetCode, Action: FilterInclude, Regex: "("}, wantErr: "invalid regex"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := tt.rule
+			cfg := &YmlConfig{InputFormat: tt.format, InputSchema: tt.schema, Filters: []*FilterRule{&r}}
+			err := compileFilters(cfg)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if r.Name != "filter-1" {
+					t.Errorf("name %s, want filter-1", r.Name)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+
+	cfg := &YmlConfig{Filters: []*FilterRule{
+		{Name: "a", Field: FilterFieldNetCode, Action: FilterInclude, Value: "x"},
+		{Name: "a", Field: FilterFieldNetCode, Action: FilterInclude, Value: "y"},
+	}}
+	if err := compileFilters(cfg); err == nil || !strings.Contains(err.Error(), "duplicate filter name, a") {
+		t.Errorf("err %v, want duplicate filter name", err)
+	}
+}
+
+func TestLoadReportCollectorRecordsFilters(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"v2.csv": "10.0.0.0|10.0.0.255|a|R00001|a|공인|00|x\n" +
+			"10.0.1.0|10.0.1.255|a|R00001|a|사설|00|x\n",
+		"v1.csv": "10.0.0.0|00|a|a|a|R00001|a|24\n",
+	})
+	cfg := &YmlConfig{
+		InputEncoding: EncodingAuto,
+		Filters:       []*FilterRule{{Field: FieldPubpri, Action: FilterInclude, Value: "공인"}},
+	}
+	if err := compileFilters(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	recs, stats, err := LoadReportCollectorRecords("ipms-v2", filepath.Join(dir, "v2.csv"), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 || recs[0].CIDR != "10.0.0.0/24" || stats.FilteredLines != 1 || stats.Filtered["filter-1"] != 1 {
+		t.Errorf("records %v, filtered lines[%d], want 10.0.0.0/24 and 1 filtered line", recs, stats.FilteredLines)
+	}
+
+	// -input-format ipms-v1 overrides the config, whose rows have no pubpri
+	_, _, err = LoadReportCollectorRecords("ipms-v1", filepath.Join(dir, "v1.csv"), cfg)
+	if err == nil || !strings.Contains(err.Error(), "input format ipms-v1 has no field pubpri") {
+		t.Errorf("err %v, want no field pubpri", err)
+	}
+}
@@ -1,29 +1,22 @@
 package ipms
 
 import (
-	"bytes"
-	"crypto/tls"
-	"encoding/json"
-	"fmt"
-	"io/ioutil"
-	"net/http"
 	"sort"
-	"strings"
 
 	"github.com/castisdev/cilog"
 )
 
 // OfficeNodeMapping :
 type OfficeNodeMapping struct {
-	OfficeCode string `json:"officeCode"`
-	NodeCode   string `json:"nodeCode"`
+	OfficeCode string `json:"officeCode" yaml:"officeCode"`
+	NodeCode   string `json:"nodeCode" yaml:"nodeCode"`
 }
 
 // NodeGLBIDMapping :
 type NodeGLBIDMapping struct {
-	NodeCode    string `json:"nodeCode"`
-	ServiceCode string `json:"serviceCode"`
-	GLBID       string `json:"glbId"`
+	NodeCode    string `json:"nodeCode" yaml:"nodeCode"`
+	ServiceCode string `json:"serviceCode" yaml:"serviceCode"`
+	GLBID       string `json:"glbId" yaml:"glbId"`
 }
 
 // OfficeGLBIDMapping :
@@ -31,89 +24,126 @@ type OfficeGLBIDMapping struct {
 	OfficeCode  string `json:"officeCode"`
 	ServiceCode string `json:"serviceCode"`
 	GLBID       string `json:"glbId"`
+	NodeCode    string `json:"nodeCode,omitempty"`
 }
 
-// GetOfficeGLBIDMapping :
+// MappingTables : the officeCode-nodeCode and nodeCode-glbId mappings as they are read
+type MappingTables struct {
+	OfficeNodes []OfficeNodeMapping
+	NodeGLBIDs  []NodeGLBIDMapping
+}
+
+// GetOfficeGLBIDMapping : officeCode-glbId mapping of GetResolvedMapping, see GetResolvedMapping for the stale mappings it used
 func GetOfficeGLBIDMapping(cfg *YmlConfig) (map[string][]OfficeGLBIDMapping, error) {
-	var officeNodes struct {
-		List []OfficeNodeMapping `json:"officeNodeMappingList"`
+	_, mapping, _, err := GetResolvedMapping(cfg)
+	return mapping, err
+}
+
+// GetResolvedMapping : the tables of GetMappingTables and their officeCode-glbId mapping resolved by multi-glb of cfg
+// the decisions of multi-glb are in MultiGLB of the status
+func GetResolvedMapping(cfg *YmlConfig) (*MappingTables, map[string][]OfficeGLBIDMapping, *MappingStatus, error) {
+	tables, status, err := GetMappingTables(cfg)
+	if err != nil {
+		return nil, nil, nil, err
 	}
-	{
-		req, err := http.NewRequest("GET", cfg.OfficeNodeAPI, nil)
-		if err != nil {
-			return nil, err
+	mapping, decisions := ResolveMultiGLB(cfg.MultiGLB, tables.OfficeGLBIDMapping())
+	status.MultiGLB = decisions
+	return tables, mapping, status, nil
+}
+
+// GetMappingTables : a mapping is read from mapping-*-file when it exists, or else from mapping-*-api
+// with mapping-cache-file, a failed api is replaced by its cached response
+func GetMappingTables(cfg *YmlConfig) (*MappingTables, *MappingStatus, error) {
+	client, err := cfg.Client()
+	if err != nil {
+		return nil, nil, err
+	}
+	maxAge, err := cfg.mappingCacheMaxAge()
+	if err != nil {
+		return nil, nil, err
+	}
+	var cache mappingCache
+	if cfg.MappingCacheFile != "" {
+		if cache, err = loadMappingCache(cfg.MappingCacheFile); err != nil {
+			cilog.Warningf("failed to load mapping cache, %v", err)
+			cache = mappingCache{}
 		}
-		cilog.Infof("%s %s", req.Method, req.URL)
+	}
+	status := &MappingStatus{}
 
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			return nil, err
+	var officeNodes []OfficeNodeMapping
+	if cfg.OfficeNodeFile != "" {
+		if officeNodes, err = readOfficeNodeFile(cfg.OfficeNodeFile); err != nil {
+			return nil, nil, err
 		}
-		defer resp.Body.Close()
-		if resp.StatusCode != http.StatusOK {
-			b, err := ioutil.ReadAll(resp.Body)
-			if err != nil {
-				cilog.Warningf("%v", err)
-			}
-			return nil, fmt.Errorf("%s, %s", resp.Status, string(b))
+		f, err := newMappingFile(mappingOfficeNode, cfg.OfficeNodeFile, len(officeNodes))
+		if err != nil {
+			return nil, nil, err
 		}
-		cilog.Infof(resp.Status)
-
-		dec := json.NewDecoder(resp.Body)
-		err = dec.Decode(&officeNodes)
+		status.Files = append(status.Files, f)
+	} else {
+		stale, err := getMappingList(client, mappingOfficeNode, cfg.OfficeNodeAPI, cache, maxAge, &officeNodes)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+		if stale != nil {
+			status.Stale = append(status.Stale, stale)
 		}
-		cilog.Infof("success to get office-code-node-code-mapping, row[%d]", len(officeNodes.List))
 	}
+	cilog.Infof("success to get office-code-node-code-mapping, row[%d]", len(officeNodes))
 
-	nodeGLBIDMap := map[string][]NodeGLBIDMapping{}
-	{
-		req, err := http.NewRequest("GET", cfg.NodeGLBIDAPI, nil)
+	var nodeGLBIDs []NodeGLBIDMapping
+	if cfg.NodeGLBIDFile != "" {
+		if nodeGLBIDs, err = readNodeGLBIDFile(cfg.NodeGLBIDFile); err != nil {
+			return nil, nil, err
+		}
+		f, err := newMappingFile(mappingNodeGLBID, cfg.NodeGLBIDFile, len(nodeGLBIDs))
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		cilog.Infof("%s %s", req.Method, req.URL)
-
-		resp, err := http.DefaultClient.Do(req)
+		status.Files = append(status.Files, f)
+	} else {
+		stale, err := getMappingList(client, mappingNodeGLBID, cfg.NodeGLBIDAPI, cache, maxAge, &nodeGLBIDs)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		defer resp.Body.Close()
-		if resp.StatusCode != http.StatusOK {
-			b, err := ioutil.ReadAll(resp.Body)
-			if err != nil {
-				cilog.Warningf("%v", err)
-			}
-			return nil, fmt.Errorf("%s, %s", resp.Status, string(b))
+		if stale != nil {
+			status.Stale = append(status.Stale, stale)
 		}
-		cilog.Infof(resp.Status)
-
-		dec := json.NewDecoder(resp.Body)
+	}
+	cilog.Infof("success to get node-code-glb-id-mapping, row[%d]", len(nodeGLBIDs))
 
-		var nodeGLBIDs struct {
-			List []NodeGLBIDMapping `json:"nodeGLBIdMappingList"`
-		}
-		err = dec.Decode(&nodeGLBIDs)
-		if err != nil {
-			return nil, err
+	for _, f := range status.Files {
+		cilog.Infof("read %v", f)
+	}
+	if cache != nil && len(status.Stale)+len(status.Files) < len(mappingListKeys) {
+		if err := saveMappingCache(cfg.MappingCacheFile, cache); err != nil {
+			cilog.Warningf("failed to save mapping cache, %v", err)
+		} else {
+			cilog.Infof("success to save mapping cache, %s", cfg.MappingCacheFile)
 		}
-		cilog.Infof("success to get node-code-glb-id-mapping, row[%d]", len(nodeGLBIDs.List))
+	}
 
-		for _, m := range nodeGLBIDs.List {
-			nodeGLBIDMap[m.NodeCode] = append(nodeGLBIDMap[m.NodeCode], m)
-		}
+	return &MappingTables{OfficeNodes: officeNodes, NodeGLBIDs: nodeGLBIDs}, status, nil
+}
+
+// OfficeGLBIDMapping : joins the mappings by nodeCode
+func (t *MappingTables) OfficeGLBIDMapping() map[string][]OfficeGLBIDMapping {
+	nodeGLBIDMap := map[string][]NodeGLBIDMapping{}
+	for _, m := range t.NodeGLBIDs {
+		nodeGLBIDMap[m.NodeCode] = append(nodeGLBIDMap[m.NodeCode], m)
 	}
 
 	failedNodes := map[string]struct{}{}
 	mapping := map[string][]OfficeGLBIDMapping{}
-	for _, m := range officeNodes.List {
+	for _, m := range t.OfficeNodes {
 		if regions, ok := nodeGLBIDMap[m.NodeCode]; ok {
 			for _, r := range regions {
 				mapping[m.OfficeCode] = append(mapping[m.OfficeCode], OfficeGLBIDMapping{
 					OfficeCode:  m.OfficeCode,
 					ServiceCode: r.ServiceCode,
 					GLBID:       r.GLBID,
+					NodeCode:    m.NodeCode,
 				})
 			}
 		} else {
@@ -125,7 +155,7 @@ func GetOfficeGLBIDMapping(cfg *YmlConfig) (map[string][]OfficeGLBIDMapping, err
 		cilog.Warningf("failed to find glbId[%s]", k)
 	}
 
-	return mapping, nil
+	return mapping
 }
 
 // NetMaskInfo :
@@ -148,40 +178,26 @@ type ServiceCodeInfo struct {
 
 // MergeIPMSRecords :
 func MergeIPMSRecords(recs []*IpmsRecord) ([]*ServiceCodeInfo, error) {
-	sort.Sort(ipmsSort(recs))
-
-	var set contSet
-	var resultSet []*IpmsRecord
-	for _, rec := range recs {
-		if set.IsCont(rec) {
-			set.Add(rec)
-		} else {
-			set.Sum()
-			set.printLog()
-			resultSet = append(resultSet, set...)
-			set = set[:0]
-			set.Add(rec)
-		}
+	resultSet, err := AggregateIPMSRecords(recs)
+	if err != nil {
+		return nil, err
 	}
 
-	// last set
-	set.Sum()
-	set.printLog()
-	resultSet = append(resultSet, set...)
-
 	var serviceCodeInfos []*ServiceCodeInfo
 	var scInfo *ServiceCodeInfo
 	var rInfo *GLBInfo
 
 	var prevServiceCode, prevGLBID string
 	for _, rec2 := range resultSet {
-		if prevServiceCode != rec2.ServiceCode {
+		if scInfo == nil || prevServiceCode != rec2.ServiceCode {
 			scInfo = &ServiceCodeInfo{}
 			scInfo.ServiceCode = rec2.ServiceCode
 			prevServiceCode = rec2.ServiceCode
 			serviceCodeInfos = append(serviceCodeInfos, scInfo)
+			// the same glbId can be used by another service code
+			rInfo = nil
 		}
-		if prevGLBID != rec2.GLBID {
+		if rInfo == nil || prevGLBID != rec2.GLBID {
 			rInfo = &GLBInfo{}
 			rInfo.GLBID = rec2.GLBID
 			prevGLBID = rec2.GLBID
@@ -201,105 +217,50 @@ type ReportCollectorRecord struct {
 }
 
 // MergeIPMSRecords2 :
+// Deprecated: the merge errors are only logged and nil is returned, use MergeReportCollectorRecords
 func MergeIPMSRecords2(recs []*IpmsRecord) []*ReportCollectorRecord {
-	sort.Sort(ipmsSort(recs))
-
-	var set contSet
-	var resultSet []*IpmsRecord
-	for _, rec := range recs {
-		if set.IsCont(rec) {
-			set.Add(rec)
-		} else {
-			set.Sum()
-			set.printLog()
-			resultSet = append(resultSet, set...)
-			set = set[:0]
-			set.Add(rec)
-		}
+	results, err := MergeReportCollectorRecords(recs)
+	if err != nil {
+		cilog.Errorf("failed to merge ipms records, %v", err)
+		return nil
 	}
+	return results
+}
 
-	// last set
-	set.Sum()
-	set.printLog()
-	resultSet = append(resultSet, set...)
+// MergeReportCollectorRecords : merged netMasks of recs in the address order
+func MergeReportCollectorRecords(recs []*IpmsRecord) ([]*ReportCollectorRecord, error) {
+	resultSet, err := AggregateIPMSRecords(recs)
+	if err != nil {
+		return nil, err
+	}
 	sort.Sort(ipmsSort2(resultSet))
 
 	var results []*ReportCollectorRecord
 	for _, rec := range resultSet {
 		results = append(results, &ReportCollectorRecord{rec.CIDR, rec.ServiceCode, rec.GLBID})
 	}
-	return results
+	return results, nil
 }
 
 // PostIPMSRecords :
 func PostIPMSRecords(cfg *YmlConfig, infos []*ServiceCodeInfo) error {
-	b := new(bytes.Buffer)
-	err := json.NewEncoder(b).Encode(infos)
+	client, err := cfg.Client()
 	if err != nil {
 		return err
 	}
-	req, err := http.NewRequest("POST", cfg.IPRoutingInfoCfgAPI, b)
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	cilog.Infof("%s %s", req.Method, req.URL)
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusCreated {
-		b, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			cilog.Warningf("%v", err)
-		}
-		return fmt.Errorf("%s, %s", resp.Status, string(b))
-	}
-	cilog.Infof(resp.Status)
-	return nil
+	return client.PostJSON(cfg.IPRoutingInfoCfgAPI, infos)
 }
 
-// PostReportCollectorRecords :
+// PostReportCollectorRecords : posts infos by a client of the default http settings
 func PostReportCollectorRecords(api string, infos []*ReportCollectorRecord) error {
-	b := new(bytes.Buffer)
-	err := json.NewEncoder(b).Encode(infos)
+	client, err := NewClient(nil)
 	if err != nil {
 		return err
 	}
-	req, err := http.NewRequest("POST", api, b)
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	cilog.Infof("%s %s", req.Method, req.URL)
-
-	var client *http.Client
-	if strings.HasPrefix(api, "https://") {
-		client = &http.Client{
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{
-					InsecureSkipVerify: true,
-				},
-			},
-		}
-	} else {
-		client = http.DefaultClient
-	}
+	return PostReportCollectorRecordsBy(client, api, infos)
+}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusCreated {
-		b, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			cilog.Warningf("%v", err)
-		}
-		return fmt.Errorf("%s, %s", resp.Status, string(b))
-	}
-	cilog.Infof(resp.Status)
-	return nil
+// PostReportCollectorRecordsBy : https uses the tls settings of client
+func PostReportCollectorRecordsBy(client *Client, api string, infos []*ReportCollectorRecord) error {
+	return client.PostJSON(api, infos)
 }
@@ -0,0 +1,25 @@
+package ipms
+
+import (
+	"testing"
+)
+
+func TestMergeIPMSRecordsSameGLBIDOfServiceCodes(t *testing.T) {
+	recs := testRecords(t, []string{"S1 A 00 10.0.0.0/24", "S2 A 00 10.0.2.0/24"})
+	infos, err := MergeIPMSRecords(recs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 {
+		t.Fatalf("serviceCodes[%d], want 2", len(infos))
+	}
+	for i, want := range []string{"10.0.0.0/24", "10.0.2.0/24"} {
+		l := infos[i].GLBIDNetMaskList
+		if len(l) != 1 || len(l[0].NetMaskAddressList) != 1 {
+			t.Fatalf("serviceCode[%s], glbIds %v", infos[i].ServiceCode, l)
+		}
+		if got := l[0].NetMaskAddressList[0].NetMaskAddress; got != want {
+			t.Errorf("serviceCode[%s], netMask[%s], want %s", infos[i].ServiceCode, got, want)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package ipms
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/castisdev/cilog"
+)
+
+// history kinds
+const (
+	HistoryIPMS            = "ipms"
+	HistoryReportCollector = "report-collector"
+
+	historyExt = ".json"
+)
+
+// HistoryInput : an input file of an import
+type HistoryInput struct {
+	File   string `json:"file"`
+	SHA256 string `json:"sha256"`
+}
+
+// HistoryEntry : a successful post, ServiceCodeInfos or ReportCollectorRecords is the full payload by Kind
+// RollbackOf is the ID of the entry that a rollback posted again
+type HistoryEntry struct {
+	ID                     string                          `json:"id"`
+	Kind                   string                          `json:"kind"`
+	Time                   time.Time                       `json:"time"`
+	API                    string                          `json:"api"`
+	ImportMode             string                          `json:"importMode,omitempty"`
+	Inputs                 []HistoryInput                  `json:"inputs"`
+	RollbackOf             string                          `json:"rollbackOf,omitempty"`
+	Mapping                map[string][]OfficeGLBIDMapping `json:"mapping,omitempty"`
+	ServiceCodeInfos       []*ServiceCodeInfo              `json:"serviceCodeInfos,omitempty"`
+	ReportCollectorRecords []*ReportCollectorRecord        `json:"reportCollectorRecords,omitempty"`
+}
+
+// NetMasks : number of netMasks of the payload
+func (e *HistoryEntry) NetMasks() int {
+	if e.Kind == HistoryReportCollector {
+		return len(e.ReportCollectorRecords)
+	}
+	n := 0
+	for _, sc := range e.ServiceCodeInfos {
+		for _, glb := range sc.GLBIDNetMaskList {
+			n += len(glb.NetMaskAddressList)
+		}
+	}
+	return n
+}
+
+func fileSHA256(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// NewHistoryEntry : entry of inputs with their checksums, ID is given by SaveHistory
+func NewHistoryEntry(kind, api string, inputs []string) (*HistoryEntry, error) {
+	e := &HistoryEntry{Kind: kind, API: api, Time: time.Now()}
+	for _, f := range inputs {
+		sum, err := fileSHA256(f)
+		if err != nil {
+			return nil, err
+		}
+		e.Inputs = append(e.Inputs, HistoryInput{File: f, SHA256: sum})
+	}
+	return e, nil
+}
+
+// SaveIPMSHistory : saves a successful import of infos when history-directory of cfg exists
+func SaveIPMSHistory(cfg *YmlConfig, inputs []string, mapping map[string][]OfficeGLBIDMapping, infos []*ServiceCodeInfo) error {
+	if cfg.HistoryDirectory == "" {
+		return nil
+	}
+	e, err := NewHistoryEntry(HistoryIPMS, cfg.IPRoutingInfoCfgAPI, inputs)
+	if err != nil {
+		return err
+	}
+	e.ImportMode = cfg.ImportMode
+	e.Mapping = mapping
+	e.ServiceCodeInfos = infos
+	return SaveHistory(cfg.HistoryDirectory, e, cfg.HistoryKeep)
+}
+
+// SaveReportCollectorHistory : saves a successful post of recs to api, nothing when dir is empty
+func SaveReportCollectorHistory(dir string, keep int, api string, inputs []string, recs []*ReportCollectorRecord) error {
+	if dir == "" {
+		return nil
+	}
+	e, err := NewHistoryEntry(HistoryReportCollector, api, inputs)
+	if err != nil {
+		return err
+	}
+	e.ReportCollectorRecords = recs
+	return SaveHistory(dir, e, keep)
+}
+
+// SaveHistory : writes e to dir as <ID>.json, ID is the time of e, like 20261017-031500
+// keep is the number of entries to keep, older entries are removed, 0 keeps every entry
+func SaveHistory(dir string, e *HistoryEntry, keep int) error {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	base := e.Time.Format("20060102-150405")
+	e.ID = base
+	for i := 2; ; i++ {
+		if _, err := os.Stat(filepath.Join(dir, e.ID+historyExt)); os.IsNotExist(err) {
+			break
+		}
+		e.ID = fmt.Sprintf("%s-%d", base, i)
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	filename := filepath.Join(dir, e.ID+historyExt)
+	tmp := filename + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		return err
+	}
+	cilog.Infof("success to save history[%s], kind[%s], netMasks[%d], %s", e.ID, e.Kind, e.NetMasks(), filename)
+
+	if keep > 0 {
+		ids, err := historyIDs(dir)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < len(ids)-keep; i++ {
+			if err := os.Remove(filepath.Join(dir, ids[i]+historyExt)); err != nil {
+				cilog.Warningf("failed to remove history[%s], %v", ids[i], err)
+				continue
+			}
+			cilog.Infof("removed old history[%s]", ids[i])
+		}
+	}
+	return nil
+}
+
+// historyIDs : sorted from the oldest
+func historyIDs(dir string) ([]string, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, fi := range fis {
+		if fi.Mode().IsRegular() && strings.HasSuffix(fi.Name(), historyExt) {
+			ids = append(ids, strings.TrimSuffix(fi.Name(), historyExt))
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		// 20261017-031500-10 comes after 20261017-031500-9
+		a, b := ids[i], ids[j]
+		if len(a) >= 15 && len(b) >= 15 && a[:15] == b[:15] && len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return ids[i] < ids[j]
+	})
+	return ids, nil
+}
+
+// LoadHistory :
+func LoadHistory(dir, id string) (*HistoryEntry, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) {
+		return nil, fmt.Errorf("invalid history id, %s", id)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, id+historyExt))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("history not exist, %s", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	e := &HistoryEntry{}
+	if err := json.Unmarshal(b, e); err != nil {
+		return nil, fmt.Errorf("history[%s], %v", id, err)
+	}
+	return e, nil
+}
+
+// ListHistory : entries of dir from the oldest
+func ListHistory(dir string) ([]*HistoryEntry, error) {
+	ids, err := historyIDs(dir)
+	if err != nil {
+		return nil, err
+	}
+	var l []*HistoryEntry
+	for _, id := range ids {
+		e, err := LoadHistory(dir, id)
+		if err != nil {
+			return nil, err
+		}
+		l = append(l, e)
+	}
+	return l, nil
+}
+
+// PrintHistory : one line per entry
+func PrintHistory(w io.Writer, entries []*HistoryEntry) {
+	fmt.Fprintln(w, "ID\tKIND\tTIME\tNET_MASKS\tINPUTS\tROLLBACK_OF")
+	for _, e := range entries {
+		var inputs []string
+		for _, in := range e.Inputs {
+			inputs = append(inputs, fmt.Sprintf("%s(%.12s)", in.File, in.SHA256))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", e.ID, e.Kind, e.Time.Format(time.RFC3339), e.NetMasks(), strings.Join(inputs, ","), e.RollbackOf)
+	}
+}
+
+// RollbackIPMS : posts the serviceCode infos of history id to import-ipms-api of cfg as a full import
+// and saves them as the last import, returns the new history entry to save by SaveHistory
+// the rollback is done even if the entry can not be saved, as an import of SaveIPMSHistory
+func RollbackIPMS(cfg *YmlConfig, id string) (*HistoryEntry, error) {
+	if cfg.HistoryDirectory == "" {
+		return nil, fmt.Errorf("history-directory not exist")
+	}
+	e, err := LoadHistory(cfg.HistoryDirectory, id)
+	if err != nil {
+		return nil, err
+	}
+	if e.Kind != HistoryIPMS {
+		return nil, fmt.Errorf("history[%s] is %s, not %s", id, e.Kind, HistoryIPMS)
+	}
+	if e.ServiceCodeInfos == nil {
+		e.ServiceCodeInfos = []*ServiceCodeInfo{}
+	}
+
+	if err := PostIPMSRecords(cfg, e.ServiceCodeInfos); err != nil {
+		return nil, err
+	}
+	cilog.Infof("success to post history[%s], netMasks[%d], %s", id, e.NetMasks(), cfg.IPRoutingInfoCfgAPI)
+
+	if cfg.LastImportFile != "" {
+		if err := SaveServiceCodeInfos(cfg.LastImportFile, e.ServiceCodeInfos); err != nil {
+			return nil, fmt.Errorf("posted, but failed to save last import, %s, %v", cfg.LastImportFile, err)
+		}
+	}
+
+	r := &HistoryEntry{
+		Kind:             HistoryIPMS,
+		Time:             time.Now(),
+		API:              cfg.IPRoutingInfoCfgAPI,
+		ImportMode:       ImportModeFull,
+		Inputs:           e.Inputs,
+		RollbackOf:       id,
+		Mapping:          e.Mapping,
+		ServiceCodeInfos: e.ServiceCodeInfos,
+	}
+	return r, nil
+}
+
+// RollbackReportCollector : posts the records of history id in dir to api
+// returns the new history entry to save by SaveHistory
+func RollbackReportCollector(client *Client, dir, id, api string) (*HistoryEntry, error) {
+	e, err := LoadHistory(dir, id)
+	if err != nil {
+		return nil, err
+	}
+	if e.Kind != HistoryReportCollector {
+		return nil, fmt.Errorf("history[%s] is %s, not %s", id, e.Kind, HistoryReportCollector)
+	}
+	if e.ReportCollectorRecords == nil {
+		e.ReportCollectorRecords = []*ReportCollectorRecord{}
+	}
+	if err := PostReportCollectorRecordsBy(client, api, e.ReportCollectorRecords); err != nil {
+		return nil, err
+	}
+	cilog.Infof("success to post history[%s], records[%d], %s", id, len(e.ReportCollectorRecords), api)
+
+	r := &HistoryEntry{
+		Kind:                   HistoryReportCollector,
+		Time:                   time.Now(),
+		API:                    api,
+		Inputs:                 e.Inputs,
+		RollbackOf:             id,
+		ReportCollectorRecords: e.ReportCollectorRecords,
+	}
+	return r, nil
+}
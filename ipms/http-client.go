@@ -0,0 +1,285 @@
+package ipms
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/castisdev/cilog"
+)
+
+// HTTPConfig : http section of the config, durations are like 5s or 1m
+// a GET is retried on a network error or 5xx, a POST only when RetryPost is true
+// every POST has an Idempotency-Key header, the same for its retries
+type HTTPConfig struct {
+	ConnectTimeout  string     `yaml:"connect-timeout"`
+	Timeout         string     `yaml:"timeout"`
+	Retries         *int       `yaml:"retries"`
+	RetryBackoff    string     `yaml:"retry-backoff"`
+	MaxRetryBackoff string     `yaml:"max-retry-backoff"`
+	RetryPost       bool       `yaml:"retry-post"`
+	TLS             *TLSConfig `yaml:"tls"`
+}
+
+// TLSConfig : tls settings of https, nil verifies the server certificate with the system CAs
+// CertFile and KeyFile are the client certificate for servers that require it
+type TLSConfig struct {
+	CAFile             string `yaml:"ca-file"`
+	CertFile           string `yaml:"cert-file"`
+	KeyFile            string `yaml:"key-file"`
+	MinVersion         string `yaml:"min-version"`
+	InsecureSkipVerify bool   `yaml:"insecure-skip-verify"`
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+const defaultTLSMinVersion = "1.2"
+
+// config : tls.Config of c, min-version is 1.2 by default
+func (c *TLSConfig) config() (*tls.Config, error) {
+	if c == nil {
+		c = &TLSConfig{}
+	}
+	minVersion := c.MinVersion
+	if minVersion == "" {
+		minVersion = defaultTLSMinVersion
+	}
+	v, ok := tlsVersions[minVersion]
+	if !ok {
+		return nil, fmt.Errorf("invalid min-version, %s, must be one of 1.0, 1.1, 1.2, 1.3", c.MinVersion)
+	}
+	tc := &tls.Config{MinVersion: v}
+
+	if c.CAFile != "" {
+		b, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca-file, %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificate in ca-file, %s", c.CAFile)
+		}
+		tc.RootCAs = pool
+	}
+
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return nil, errors.New("cert-file and key-file must be set together")
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load cert-file, key-file, %v", err)
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+
+	tc.InsecureSkipVerify = c.InsecureSkipVerify
+	return tc, nil
+}
+
+// defaults of HTTPConfig
+const (
+	defaultConnectTimeout  = 5 * time.Second
+	defaultTimeout         = 60 * time.Second
+	defaultRetries         = 2
+	defaultRetryBackoff    = 1 * time.Second
+	defaultMaxRetryBackoff = 30 * time.Second
+)
+
+// Client : http client shared by the mapping gets and the posts
+type Client struct {
+	hc              *http.Client
+	retries         int
+	retryBackoff    time.Duration
+	maxRetryBackoff time.Duration
+	retryPost       bool
+	insecure        bool
+	sleep           func(time.Duration)
+}
+
+// NewClient : nil cfg is the defaults
+func NewClient(cfg *HTTPConfig) (*Client, error) {
+	if cfg == nil {
+		cfg = &HTTPConfig{}
+	}
+	connectTimeout, err := parseDuration(cfg.ConnectTimeout, defaultConnectTimeout)
+	if err != nil || connectTimeout <= 0 {
+		return nil, fmt.Errorf("invalid connect-timeout, %s", cfg.ConnectTimeout)
+	}
+	timeout, err := parseDuration(cfg.Timeout, defaultTimeout)
+	if err != nil || timeout <= 0 {
+		return nil, fmt.Errorf("invalid timeout, %s", cfg.Timeout)
+	}
+	c := &Client{retries: defaultRetries, retryPost: cfg.RetryPost, sleep: time.Sleep}
+	if cfg.Retries != nil {
+		if *cfg.Retries < 0 {
+			return nil, fmt.Errorf("invalid retries[%d]", *cfg.Retries)
+		}
+		c.retries = *cfg.Retries
+	}
+	c.retryBackoff, err = parseDuration(cfg.RetryBackoff, defaultRetryBackoff)
+	if err != nil || c.retryBackoff < 0 {
+		return nil, fmt.Errorf("invalid retry-backoff, %s", cfg.RetryBackoff)
+	}
+	c.maxRetryBackoff, err = parseDuration(cfg.MaxRetryBackoff, defaultMaxRetryBackoff)
+	if err != nil || c.maxRetryBackoff < c.retryBackoff {
+		return nil, fmt.Errorf("invalid max-retry-backoff, %s", cfg.MaxRetryBackoff)
+	}
+
+	tc, err := cfg.TLS.config()
+	if err != nil {
+		return nil, fmt.Errorf("invalid tls, %v", err)
+	}
+	c.insecure = tc.InsecureSkipVerify
+
+	c.hc = &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   connectTimeout,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			TLSClientConfig:     tc,
+			TLSHandshakeTimeout: connectTimeout,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+	return c, nil
+}
+
+// newIdempotencyKey : random uuid version 4
+func newIdempotencyKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.retryBackoff
+	for i := 1; i < attempt && d < c.maxRetryBackoff; i++ {
+		d *= 2
+	}
+	if d > c.maxRetryBackoff {
+		d = c.maxRetryBackoff
+	}
+	return d
+}
+
+// do : sends the request until the status is expect, the status is not 5xx, or retries are used up
+// the body of the returned response is open when err is nil
+func (c *Client) do(method, api string, body []byte, header http.Header, retry bool, expect int) (*http.Response, error) {
+	retries := 0
+	if retry {
+		retries = c.retries
+	}
+	for attempt := 0; ; attempt++ {
+		var r io.Reader
+		if body != nil {
+			r = bytes.NewReader(body)
+		}
+		req, err := http.NewRequest(method, api, r)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		cilog.Infof("%s %s", req.Method, req.URL)
+		if c.insecure && req.URL.Scheme == "https" {
+			cilog.Warningf("the server certificate is not verified by tls insecure-skip-verify")
+		}
+
+		resp, err := c.hc.Do(req)
+		if err == nil {
+			if resp.StatusCode == expect {
+				cilog.Infof(resp.Status)
+				return resp, nil
+			}
+			b, rerr := ioutil.ReadAll(resp.Body)
+			if rerr != nil {
+				cilog.Warningf("%v", rerr)
+			}
+			resp.Body.Close()
+			err = fmt.Errorf("%s, %s", resp.Status, string(b))
+			if resp.StatusCode < 500 {
+				return nil, err
+			}
+		}
+		if attempt >= retries {
+			if attempt > 0 {
+				return nil, fmt.Errorf("%v, after retries[%d]", err, attempt)
+			}
+			return nil, err
+		}
+		d := c.backoff(attempt + 1)
+		cilog.Warningf("retry[%d/%d] %s %s after %v, %v", attempt+1, retries, method, api, d, err)
+		c.sleep(d)
+	}
+}
+
+// GetJSON : decodes the body of 200 OK into v
+func (c *Client) GetJSON(api string, v interface{}) error {
+	resp, err := c.do("GET", api, nil, nil, true, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// PostJSON : posts v as json, the response must be 201 Created
+func (c *Client) PostJSON(api string, v interface{}) error {
+	b := new(bytes.Buffer)
+	if err := json.NewEncoder(b).Encode(v); err != nil {
+		return err
+	}
+	key, err := newIdempotencyKey()
+	if err != nil {
+		return err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("Idempotency-Key", key)
+	cilog.Infof("Idempotency-Key %s", key)
+
+	resp, err := c.do("POST", api, b.Bytes(), header, c.retryPost, http.StatusCreated)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Client : the client of the http section, created once
+func (cfg *YmlConfig) Client() (*Client, error) {
+	if cfg == nil {
+		return NewClient(nil)
+	}
+	if cfg.client == nil {
+		c, err := NewClient(cfg.HTTP)
+		if err != nil {
+			return nil, err
+		}
+		cfg.client = c
+	}
+	return cfg.client, nil
+}
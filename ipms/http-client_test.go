@@ -0,0 +1,156 @@
+package ipms
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// failServer : answers 503 to the first fails requests, then status
+// it keeps the Idempotency-Key of every request
+type failServer struct {
+	mu     sync.Mutex
+	fails  int
+	status int
+	keys   []string
+}
+
+func (s *failServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = append(s.keys, r.Header.Get("Idempotency-Key"))
+	if len(s.keys) <= s.fails {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(s.status)
+	if r.Method == "GET" {
+		fmt.Fprint(w, `{"a":1}`)
+	}
+}
+
+func newTestClient(t *testing.T, cfg *HTTPConfig, sleeps *[]time.Duration) *Client {
+	c, err := NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.sleep = func(d time.Duration) { *sleeps = append(*sleeps, d) }
+	return c
+}
+
+func TestClientRetries(t *testing.T) {
+	retries := func(n int) *int { return &n }
+	tests := []struct {
+		name     string
+		method   string
+		cfg      HTTPConfig
+		fails    int
+		wantErr  bool
+		requests int
+		sleeps   []time.Duration
+	}{
+		{
+			name:     "GET retried on 503",
+			method:   "GET",
+			cfg:      HTTPConfig{Retries: retries(3), RetryBackoff: "1s", MaxRetryBackoff: "30s"},
+			fails:    2,
+			requests: 3,
+			sleeps:   []time.Duration{time.Second, 2 * time.Second},
+		},
+		{
+			name:     "GET fails after retries",
+			method:   "GET",
+			cfg:      HTTPConfig{Retries: retries(2), RetryBackoff: "1s", MaxRetryBackoff: "30s"},
+			fails:    5,
+			wantErr:  true,
+			requests: 3,
+			sleeps:   []time.Duration{time.Second, 2 * time.Second},
+		},
+		{
+			name:     "backoff capped by max-retry-backoff",
+			method:   "GET",
+			cfg:      HTTPConfig{Retries: retries(4), RetryBackoff: "1s", MaxRetryBackoff: "3s"},
+			fails:    4,
+			requests: 5,
+			sleeps:   []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second},
+		},
+		{
+			name:     "POST not retried",
+			method:   "POST",
+			cfg:      HTTPConfig{Retries: retries(3), RetryBackoff: "1s", MaxRetryBackoff: "30s"},
+			fails:    1,
+			wantErr:  true,
+			requests: 1,
+		},
+		{
+			name:     "POST retried by retry-post",
+			method:   "POST",
+			cfg:      HTTPConfig{Retries: retries(3), RetryBackoff: "1s", MaxRetryBackoff: "30s", RetryPost: true},
+			fails:    2,
+			requests: 3,
+			sleeps:   []time.Duration{time.Second, 2 * time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := http.StatusOK
+			if tt.method == "POST" {
+				status = http.StatusCreated
+			}
+			s := &failServer{fails: tt.fails, status: status}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			var sleeps []time.Duration
+			c := newTestClient(t, &tt.cfg, &sleeps)
+			var err error
+			if tt.method == "GET" {
+				var v map[string]int
+				err = c.GetJSON(ts.URL, &v)
+			} else {
+				err = c.PostJSON(ts.URL, []string{"a"})
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(s.keys) != tt.requests {
+				t.Errorf("requests[%d], want %d", len(s.keys), tt.requests)
+			}
+			if fmt.Sprint(sleeps) != fmt.Sprint(tt.sleeps) {
+				t.Errorf("sleeps %v, want %v", sleeps, tt.sleeps)
+			}
+			if tt.method == "POST" {
+				for _, k := range s.keys {
+					if k == "" || k != s.keys[0] {
+						t.Errorf("Idempotency-Key %q, want the same key for every retry", s.keys)
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestClientNoRetryOn4xx(t *testing.T) {
+	n := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	var sleeps []time.Duration
+	c := newTestClient(t, nil, &sleeps)
+	var v interface{}
+	if err := c.GetJSON(ts.URL, &v); err == nil {
+		t.Error("no error of 400")
+	}
+	if n != 1 || len(sleeps) != 0 {
+		t.Errorf("requests[%d], sleeps %v, want 1 request and no sleep", n, sleeps)
+	}
+}
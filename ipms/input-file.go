@@ -0,0 +1,195 @@
+package ipms
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/castisdev/cilog"
+)
+
+// input compressions
+const (
+	compressionNone  = ""
+	compressionGzip  = "gzip"
+	compressionZip   = "zip"
+	compressionTarGz = "tar.gz"
+)
+
+// detectCompression : by the file extension, or by the magic number when the extension is unknown
+func detectCompression(filename string) (string, error) {
+	lower := strings.ToLower(filename)
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return compressionTarGz, nil
+	case strings.HasSuffix(lower, ".gz"):
+		return compressionGzip, nil
+	case strings.HasSuffix(lower, ".zip"):
+		return compressionZip, nil
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	magic := make([]byte, 4)
+	n, _ := io.ReadFull(f, magic)
+	magic = magic[:n]
+	switch {
+	case n >= 2 && magic[0] == 0x1f && magic[1] == 0x8b:
+		return compressionGzip, nil
+	case n == 4 && string(magic) == "PK\x03\x04":
+		return compressionZip, nil
+	}
+	return compressionNone, nil
+}
+
+type multiCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (c *multiCloser) Close() error {
+	var err error
+	for i := len(c.closers) - 1; i >= 0; i-- {
+		if e := c.closers[i].Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func matchEntry(pattern, name string) bool {
+	if pattern == "" {
+		pattern = "*"
+	}
+	ok, err := filepath.Match(pattern, filepath.Base(name))
+	return err == nil && ok
+}
+
+// OpenInput : opens filename, .gz is decompressed, and the first entry matching entryPattern is read
+// from .zip, .tar.gz and .tgz, entryPattern is a glob of the entry base name, empty means every entry
+func OpenInput(filename, entryPattern string) (io.ReadCloser, error) {
+	compression, err := detectCompression(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	switch compression {
+	case compressionGzip:
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		gz, err := gzip.NewReader(bufio.NewReader(f))
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s, %v", filename, err)
+		}
+		return &multiCloser{gz, []io.Closer{f, gz}}, nil
+
+	case compressionTarGz:
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		gz, err := gzip.NewReader(bufio.NewReader(f))
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s, %v", filename, err)
+		}
+		tr := tar.NewReader(gz)
+		for {
+			h, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				gz.Close()
+				f.Close()
+				return nil, fmt.Errorf("%s, %v", filename, err)
+			}
+			if h.Typeflag != tar.TypeReg || !matchEntry(entryPattern, h.Name) {
+				continue
+			}
+			cilog.Infof("read %s in %s", h.Name, filename)
+			return &multiCloser{tr, []io.Closer{f, gz}}, nil
+		}
+		gz.Close()
+		f.Close()
+		return nil, fmt.Errorf("%s, no entry matches %q", filename, entryPattern)
+
+	case compressionZip:
+		zr, err := zip.OpenReader(filename)
+		if err != nil {
+			return nil, fmt.Errorf("%s, %v", filename, err)
+		}
+		for _, zf := range zr.File {
+			if zf.FileInfo().IsDir() || !matchEntry(entryPattern, zf.Name) {
+				continue
+			}
+			r, err := zf.Open()
+			if err != nil {
+				zr.Close()
+				return nil, fmt.Errorf("%s, %v", filename, err)
+			}
+			cilog.Infof("read %s in %s", zf.Name, filename)
+			return &multiCloser{r, []io.Closer{zr, r}}, nil
+		}
+		zr.Close()
+		return nil, fmt.Errorf("%s, no entry matches %q", filename, entryPattern)
+	}
+
+	return os.Open(filename)
+}
+
+// ExtractInput : for the readers that need a plain file path, like sqlite
+// a compressed input is extracted to a temporary file, cleanup removes it
+func ExtractInput(filename, entryPattern string) (path string, cleanup func(), err error) {
+	compression, err := detectCompression(filename)
+	if err != nil {
+		return "", nil, err
+	}
+	if compression == compressionNone {
+		return filename, func() {}, nil
+	}
+
+	r, err := OpenInput(filename, entryPattern)
+	if err != nil {
+		return "", nil, err
+	}
+	defer r.Close()
+
+	tmp, err := ioutil.TempFile("", "ipms-input-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup = func() {
+		os.Remove(tmp.Name())
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		cleanup()
+		return "", nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return tmp.Name(), cleanup, nil
+}
+
+func inputArchiveEntry(cfg *YmlConfig) string {
+	if cfg == nil {
+		return ""
+	}
+	return cfg.InputArchiveEntry
+}
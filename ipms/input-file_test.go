@@ -0,0 +1,157 @@
+package ipms
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func gzipBytes(t *testing.T, content string) []byte {
+	var b bytes.Buffer
+	gz := gzip.NewWriter(&b)
+	if _, err := gz.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// zipBytes : entries are name and content pairs, in order
+func zipBytes(t *testing.T, entries ...string) []byte {
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	for i := 0; i < len(entries); i += 2 {
+		w, err := zw.Create(entries[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(entries[i+1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// tarGzBytes : entries are name and content pairs, in order
+func tarGzBytes(t *testing.T, entries ...string) []byte {
+	var b bytes.Buffer
+	tw := tar.NewWriter(&b)
+	if err := tw.WriteHeader(&tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(entries); i += 2 {
+		if err := tw.WriteHeader(&tar.Header{Name: entries[i], Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(entries[i+1]))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(entries[i+1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return gzipBytes(t, b.String())
+}
+
+func TestOpenInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content []byte
+		entry   string
+		want    string
+		wantErr string // empty when it opens
+	}{
+		{name: "plain", file: "in.csv", content: []byte("a\n"), want: "a\n"},
+		{name: "gz", file: "in.csv.gz", content: gzipBytes(t, "a\n"), want: "a\n"},
+		{name: "gz without extension", file: "in", content: gzipBytes(t, "a\n"), want: "a\n"},
+		{name: "zip first entry", file: "in.zip", content: zipBytes(t, "readme.txt", "r", "IPMS-1.csv", "a\n"), want: "r"},
+		{name: "zip entry pattern", file: "in.zip", content: zipBytes(t, "readme.txt", "r", "dir/IPMS-1.csv", "a\n"), entry: "IPMS-*.csv", want: "a\n"},
+		{name: "zip without extension", file: "in", content: zipBytes(t, "IPMS-1.csv", "a\n"), want: "a\n"},
+		{name: "zip no entry matches", file: "in.zip", content: zipBytes(t, "readme.txt", "r"), entry: "IPMS-*.csv", wantErr: `no entry matches "IPMS-*.csv"`},
+		{name: "tar.gz entry pattern", file: "in.tar.gz", content: tarGzBytes(t, "dir/readme.txt", "r", "dir/IPMS-1.csv", "a\n"), entry: "IPMS-*.csv", want: "a\n"},
+		{name: "tgz", file: "in.tgz", content: tarGzBytes(t, "IPMS-1.csv", "a\n"), want: "a\n"},
+		{name: "tar.gz no entry matches", file: "in.tar.gz", content: tarGzBytes(t, "readme.txt", "r"), entry: "IPMS-*.csv", wantErr: "no entry matches"},
+		{name: "broken gz", file: "in.csv.gz", content: []byte("not gzip"), wantErr: "in.csv.gz"},
+		{name: "broken zip", file: "in.zip", content: []byte("not zip"), wantErr: "in.zip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeTestFiles(t, map[string]string{tt.file: string(tt.content)})
+			r, err := OpenInput(filepath.Join(dir, tt.file), tt.entry)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			b, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.want {
+				t.Errorf("content %q, want %q", b, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractInput(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{"in.db": "db", "in.db.gz": string(gzipBytes(t, "gz db"))})
+
+	path, cleanup, err := ExtractInput(filepath.Join(dir, "in.db"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup()
+	if path != filepath.Join(dir, "in.db") {
+		t.Errorf("path %s, want the input itself", path)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("cleanup removed the input, %v", err)
+	}
+
+	path, cleanup, err = ExtractInput(filepath.Join(dir, "in.db.gz"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(path); err != nil || string(b) != "gz db" {
+		t.Errorf("extracted %q, %v, want gz db", b, err)
+	}
+	cleanup()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("extracted file not removed, %v", err)
+	}
+}
+
+func TestLoadIPMSRecordsArchive(t *testing.T) {
+	// an EUC-KR ipms-v2 file in a zip
+	dir := writeTestFiles(t, map[string]string{
+		"in.zip": string(zipBytes(t, "IPMS-1.csv", "10.0.0.0|10.0.0.255|a|R00001|\xbe\xe7\xc0\xe7|x|00|x\n10.0.1.0|10.0.1.255|a|R00001|a|x|00\n")),
+	})
+	cfg := testImportConfig(t, dir)
+	cfg.InputArchiveEntry = "IPMS-*.csv"
+	r, err := LoadImport(cfg, "ipms-v2", []string{filepath.Join(dir, "in.zip")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := r.InputStats.Stats[0]
+	if len(r.Records) != 1 || r.Records[0].CIDR != "10.0.0.0/24" || st.Lines != 2 || st.InvalidLines != 1 {
+		t.Errorf("records %v, lines[%d], invalid lines[%d], want 10.0.0.0/24 of 2 lines and 1 invalid line", r.Records, st.Lines, st.InvalidLines)
+	}
+}
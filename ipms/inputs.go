@@ -0,0 +1,205 @@
+package ipms
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/castisdev/cilog"
+)
+
+// ExpandInputs : input files of the command line arguments
+// an argument is a file, a directory of files or a glob pattern, files of a directory and of a glob are sorted by name
+// hidden files and subdirectories of a directory are skipped, a file given twice is read once
+func ExpandInputs(args []string) ([]string, error) {
+	var files []string
+	seen := map[string]struct{}{}
+	add := func(f string) {
+		if _, ok := seen[filepath.Clean(f)]; ok {
+			return
+		}
+		seen[filepath.Clean(f)] = struct{}{}
+		files = append(files, f)
+	}
+
+	for _, arg := range args {
+		if strings.ContainsAny(arg, "*?[") {
+			matches, err := filepath.Glob(arg)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern, %s, %v", arg, err)
+			}
+			n := 0
+			sort.Strings(matches)
+			for _, m := range matches {
+				fi, err := os.Stat(m)
+				if err != nil || !fi.Mode().IsRegular() {
+					continue
+				}
+				add(m)
+				n++
+			}
+			if n == 0 {
+				return nil, fmt.Errorf("no input file matches, %s", arg)
+			}
+			continue
+		}
+
+		fi, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			add(arg)
+			continue
+		}
+		fis, err := ioutil.ReadDir(arg)
+		if err != nil {
+			return nil, err
+		}
+		n := 0
+		for _, fi := range fis {
+			if !fi.Mode().IsRegular() || strings.HasPrefix(fi.Name(), ".") {
+				continue
+			}
+			add(filepath.Join(arg, fi.Name()))
+			n++
+		}
+		if n == 0 {
+			return nil, fmt.Errorf("no input file in directory, %s", arg)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("there is no input file")
+	}
+	return files, nil
+}
+
+// InputStats : statistics of every input file
+// Duplicates is the number of records dropped because another file has the same record
+type InputStats struct {
+	Files      []string
+	Stats      []*SourceStats
+	Duplicates int
+}
+
+// Lines : per file statistics
+func (s *InputStats) Lines() []string {
+	var lines []string
+	for i, f := range s.Files {
+		st := s.Stats[i]
+		lines = append(lines, fmt.Sprintf("input file[%s], lines[%d], invalid lines[%d], filtered lines[%d], records[%d], unknown office codes[%d]",
+			f, st.Lines, st.InvalidLines, st.FilteredLines, st.Records, len(st.FailedOfficeCodes)))
+		if st.MultiGLBRejectedLines > 0 {
+			lines[len(lines)-1] += fmt.Sprintf(", multi-glb rejected lines[%d]", st.MultiGLBRejectedLines)
+		}
+	}
+	filtered := s.Filtered()
+	var names []string
+	for name := range filtered {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("filter[%s], filtered lines[%d]", name, filtered[name]))
+	}
+	if len(s.Files) > 1 {
+		lines = append(lines, fmt.Sprintf("input files[%d], duplicate records across files[%d]", len(s.Files), s.Duplicates))
+	}
+	return lines
+}
+
+// Filtered : filtered lines of every file by filter rule
+func (s *InputStats) Filtered() map[string]int {
+	m := map[string]int{}
+	for _, st := range s.Stats {
+		for name, n := range st.Filtered {
+			m[name] += n
+		}
+	}
+	return m
+}
+
+type recordKey struct {
+	serviceCode string
+	glbID       string
+	netCode     string
+	cidr        string
+}
+
+// loadFiles : reads every file with load and combines the records
+// a record of a file that an earlier file already has is dropped
+func loadFiles(filenames []string, load func(filename string) ([]*IpmsRecord, *SourceStats, error)) ([]*IpmsRecord, *InputStats, error) {
+	var recs []*IpmsRecord
+	stats := &InputStats{}
+	first := map[recordKey]*IpmsRecord{}
+	for _, filename := range filenames {
+		set, st, err := load(filename)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s, %v", filename, err)
+		}
+		// records and dropped records of each line, a line is rejected only when every record is dropped
+		lines := map[int]int{}
+		dropped := map[int][]*Reject{}
+		for _, rec := range set {
+			rec.Source = filename
+			lines[rec.Line]++
+			k := recordKey{rec.ServiceCode, rec.GLBID, rec.NetCode, rec.CIDR}
+			if prev, ok := first[k]; ok && prev.Source != filename {
+				cilog.Warningf("duplicate record across files, %s line[%d], %s line[%d], serviceCode[%s], glbId[%s], netMask[%s]",
+					prev.Source, prev.Line, filename, rec.Line, rec.ServiceCode, rec.GLBID, rec.CIDR)
+				stats.Duplicates++
+				dropped[rec.Line] = append(dropped[rec.Line], &Reject{
+					Line:       rec.Line,
+					Reason:     RejectDuplicate,
+					Detail:     fmt.Sprintf("netMask[%s], same as %s line[%d]", rec.CIDR, prev.Source, prev.Line),
+					OfficeCode: strings.TrimSpace(rec.OfficeCode),
+					Raw:        rec.Raw,
+				})
+				continue
+			} else if !ok {
+				first[k] = rec
+			}
+			recs = append(recs, rec)
+		}
+		for line, l := range dropped {
+			// one reject for a line, though the line has a record of every glbId
+			if len(l) == lines[line] {
+				st.Rejects = append(st.Rejects, l[0])
+			}
+		}
+		sort.SliceStable(st.Rejects, func(i, j int) bool { return st.Rejects[i].Line < st.Rejects[j].Line })
+		for _, r := range st.Rejects {
+			r.File = filename
+		}
+		stats.Files = append(stats.Files, filename)
+		stats.Stats = append(stats.Stats, st)
+	}
+	if len(filenames) > 1 {
+		cilog.Infof("success to parse input files[%d], records[%d], duplicate records across files[%d]", len(filenames), len(recs), stats.Duplicates)
+	}
+	return recs, stats, nil
+}
+
+// LoadIPMSRecordsFiles : LoadIPMSRecords of every file, combined
+func LoadIPMSRecordsFiles(format string, filenames []string, cfg *YmlConfig, mapping map[string][]OfficeGLBIDMapping, decisions []*MultiGLBDecision) ([]*IpmsRecord, *InputStats, error) {
+	return loadFiles(filenames, func(filename string) ([]*IpmsRecord, *SourceStats, error) {
+		return LoadIPMSRecords(format, filename, cfg, mapping, decisions)
+	})
+}
+
+// LoadReportCollectorRecordsFiles : LoadReportCollectorRecords of every file, combined
+func LoadReportCollectorRecordsFiles(format string, filenames []string, cfg *YmlConfig) ([]*IpmsRecord, *InputStats, error) {
+	return loadFiles(filenames, func(filename string) ([]*IpmsRecord, *SourceStats, error) {
+		return LoadReportCollectorRecords(format, filename, cfg)
+	})
+}
+
+func sourcePrefix(rec *IpmsRecord) string {
+	if rec.Source == "" {
+		return ""
+	}
+	return fmt.Sprintf("file[%s], ", rec.Source)
+}
@@ -0,0 +1,36 @@
+package ipms
+
+import (
+	"testing"
+)
+
+func TestLoadFilesDuplicateRejects(t *testing.T) {
+	files := map[string][]string{
+		"a": {"S A 00 10.0.0.0/24", "S A 00 10.0.1.0/24"},
+		// line 1 has every record in a, line 2 has one record that a does not have
+		"b": {"S A 00 10.0.0.0/24", "S A 00 10.0.1.0/24", "S A 00 10.0.2.0/24"},
+	}
+	lines := map[string][]int{"a": {1, 2}, "b": {1, 2, 2}}
+	load := func(filename string) ([]*IpmsRecord, *SourceStats, error) {
+		recs := testRecords(t, files[filename])
+		for i, rec := range recs {
+			rec.Line = lines[filename][i]
+		}
+		return recs, &SourceStats{}, nil
+	}
+
+	recs, stats, err := loadFiles([]string{"a", "b"}, load)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 3 {
+		t.Errorf("records[%d], want 3", len(recs))
+	}
+	if stats.Duplicates != 2 {
+		t.Errorf("duplicates[%d], want 2", stats.Duplicates)
+	}
+	rejects := stats.Rejects()
+	if len(rejects) != 1 || rejects[0].File != "b" || rejects[0].Line != 1 || rejects[0].Reason != RejectDuplicate {
+		t.Errorf("rejects %v, want a duplicate of b line[1]", rejects)
+	}
+}
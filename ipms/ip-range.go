@@ -0,0 +1,112 @@
+package ipms
+
+import (
+	"fmt"
+	"net"
+	"sort"
+)
+
+// IPRange : inclusive address range, Start and End are the same address family
+type IPRange struct {
+	Start net.IP
+	End   net.IP
+}
+
+func (r IPRange) String() string {
+	return fmt.Sprintf("%v-%v", r.Start, r.End)
+}
+
+// CIDRs :
+func (r IPRange) CIDRs() []*net.IPNet {
+	return Range2CIDRs(r.Start, r.End)
+}
+
+type ipRangeSort []IPRange
+
+func (s ipRangeSort) Len() int {
+	return len(s)
+}
+func (s ipRangeSort) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s ipRangeSort) Less(i, j int) bool {
+	return cmp(s[i].Start, s[j].Start) < 0
+}
+
+func prev(ip net.IP) net.IP {
+	n := len(ip)
+	out := make(net.IP, n)
+	copy := false
+	for n > 0 {
+		n--
+		if copy {
+			out[n] = ip[n]
+			continue
+		}
+		if ip[n] > 0 {
+			out[n] = ip[n] - 1
+			copy = true
+			continue
+		}
+		out[n] = 0xff
+	}
+	return out
+}
+
+// joinable : b overlaps or directly follows a, a.Start <= b.Start
+func joinable(a, b IPRange) bool {
+	if len(a.End) != len(b.Start) {
+		return false
+	}
+	return cmp(b.Start, a.End) <= 0 || (!isAllFF(a.End) && cmp(next(a.End), b.Start) == 0)
+}
+
+// mergeRanges : sorts and joins overlapping or adjacent ranges
+func mergeRanges(rs []IPRange) []IPRange {
+	if len(rs) == 0 {
+		return nil
+	}
+	sorted := make([]IPRange, len(rs))
+	copy(sorted, rs)
+	sort.Sort(ipRangeSort(sorted))
+
+	merged := []IPRange{sorted[0]}
+	for _, r := range sorted[1:] {
+		cur := &merged[len(merged)-1]
+		if joinable(*cur, r) {
+			if cmp(r.End, cur.End) > 0 {
+				cur.End = r.End
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// subtractRanges : a - b, both must be merged by mergeRanges
+func subtractRanges(a, b []IPRange) []IPRange {
+	var out []IPRange
+	j := 0
+	for _, r := range a {
+		start := r.Start
+		for j < len(b) && cmp(b[j].End, start) < 0 {
+			j++
+		}
+		done := false
+		for k := j; k < len(b) && cmp(b[k].Start, r.End) <= 0; k++ {
+			if cmp(b[k].Start, start) > 0 {
+				out = append(out, IPRange{start, prev(b[k].Start)})
+			}
+			if cmp(b[k].End, r.End) >= 0 {
+				done = true
+				break
+			}
+			start = next(b[k].End)
+		}
+		if !done {
+			out = append(out, IPRange{start, r.End})
+		}
+	}
+	return out
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"net"
+	"sort"
 	"strconv"
 
 	"github.com/castisdev/cilog"
@@ -27,7 +28,7 @@ func (s ipmsSort) Less(i, j int) bool {
 	if s[i].NetCode != s[j].NetCode {
 		return s[i].NetCode < s[j].NetCode
 	}
-	return s[i].IPStartInt < s[j].IPStartInt
+	return cmp(s[i].IPStart, s[j].IPStart) < 0
 }
 
 type ipmsSort2 []*IpmsRecord
@@ -39,18 +40,14 @@ func (s ipmsSort2) Swap(i, j int) {
 	s[i], s[j] = s[j], s[i]
 }
 func (s ipmsSort2) Less(i, j int) bool {
-	return s[i].IPStartInt < s[j].IPStartInt
-}
-
-func int2ip(nn uint32) net.IP {
-	ip := make(net.IP, 4)
-	binary.BigEndian.PutUint32(ip, nn)
-	return ip
+	return cmp(s[i].IPStart, s[j].IPStart) < 0
 }
 
 // IpmsRecord :
+// IPStart is 4 bytes for IPv4 and 16 bytes for IPv6
 type IpmsRecord struct {
-	IPStart     net.IP
+	IPStart net.IP
+	// Deprecated: IPStartInt is IPStart of IPv4 as an integer and 0 for IPv6, use IPStart
 	IPStartInt  int
 	Prefix      int
 	ServiceCode string `json:"serviceCode"`
@@ -59,6 +56,9 @@ type IpmsRecord struct {
 	OfficeCode  string
 	CIDR        string `json:"netMaskAddress"`
 	IPNet       *net.IPNet
+	Source      string
+	Line        int
+	Raw         string
 }
 
 func simpleMaskLength(mask net.IPMask) int {
@@ -88,6 +88,14 @@ func simpleMaskLength(mask net.IPMask) int {
 	return n
 }
 
+// ipStartInt : 0 for IPv6
+func ipStartInt(ip net.IP) int {
+	if len(ip) != net.IPv4len {
+		return 0
+	}
+	return int(binary.BigEndian.Uint32(ip))
+}
+
 // NewRecordFromCIDR :
 func NewRecordFromCIDR(serviceCode, glbID, netCode, officeCode string, cidr *net.IPNet) (*IpmsRecord, error) {
 	rec := &IpmsRecord{
@@ -97,12 +105,16 @@ func NewRecordFromCIDR(serviceCode, glbID, netCode, officeCode string, cidr *net
 		OfficeCode:  officeCode,
 	}
 
-	rec.Prefix = simpleMaskLength(cidr.Mask)
-
-	rec.CIDR = cidr.String()
-	rec.IPNet = cidr
-	rec.IPStart = cidr.IP
-	rec.IPStartInt = int(binary.BigEndian.Uint32(rec.IPStart))
+	// re-parse so that an IPv4 block always has 4 bytes address and mask
+	var err error
+	_, rec.IPNet, err = net.ParseCIDR(cidr.String())
+	if err != nil {
+		return nil, err
+	}
+	rec.Prefix = simpleMaskLength(rec.IPNet.Mask)
+	rec.CIDR = rec.IPNet.String()
+	rec.IPStart = normalizeIP(rec.IPNet.IP)
+	rec.IPStartInt = ipStartInt(rec.IPStart)
 
 	return rec, nil
 }
@@ -123,107 +135,80 @@ func NewRecord(serviceCode, glbID, netCode, officeCode, ipStart, prefix string)
 	}
 
 	rec.CIDR = fmt.Sprintf("%s/%d", ipStart, rec.Prefix)
-	var ip net.IP
-	ip, rec.IPNet, err = net.ParseCIDR(rec.CIDR)
-	rec.IPStart = ip.Mask(rec.IPNet.Mask)
-	rec.IPStartInt = int(binary.BigEndian.Uint32(rec.IPStart))
+	_, rec.IPNet, err = net.ParseCIDR(rec.CIDR)
 	if err != nil {
 		return nil, err
 	}
+	rec.IPStart = normalizeIP(rec.IPNet.IP)
+	rec.IPStartInt = ipStartInt(rec.IPStart)
 	return rec, nil
 }
 
-func (r *IpmsRecord) nextStartIP() net.IP {
-	startInt := binary.BigEndian.Uint32(r.IPStart)
-	endInt := startInt + (1 << uint(32-r.Prefix))
-	return int2ip(endInt)
+// Range :
+func (r *IpmsRecord) Range() IPRange {
+	return IPRange{r.IPStart, last(r.IPStart, r.IPNet.Mask)}
 }
 
-func (r *IpmsRecord) canStart() bool {
-	ip, ipnet, err := net.ParseCIDR(fmt.Sprintf("%v/%d", r.IPStart, r.Prefix-1))
-	if err != nil {
-		return false
+func printLog(recs []*IpmsRecord) {
+	for _, rec := range recs {
+		cilog.Infof("success to parse ipms data, serviceCode[%s], glbId[%s], netCode[%s], netMask[%v]", rec.ServiceCode, rec.GLBID, rec.NetCode, rec.IPNet)
 	}
-	return ip.Mask(ipnet.Mask).String() == r.IPStart.String()
 }
 
-type contSet []*IpmsRecord
-
-func (set contSet) printLog() {
-	for _, rec := range set {
-		cilog.Infof("success to parse ipms data, serviceCode[%s], glbId[%s], netCode[%s], netMask[%v]", rec.ServiceCode, rec.GLBID, rec.NetCode, rec.IPNet)
-	}
+func sameGroup(r1, r2 *IpmsRecord) bool {
+	return r1.ServiceCode == r2.ServiceCode && r1.GLBID == r2.GLBID && r1.NetCode == r2.NetCode
 }
 
-func newParent(first, second *IpmsRecord) (*IpmsRecord, error) {
-	rec := &IpmsRecord{
-		ServiceCode: first.ServiceCode,
-		NetCode:     first.NetCode,
-		GLBID:       first.GLBID,
-		OfficeCode:  first.OfficeCode,
-		Prefix:      first.Prefix - 1,
-	}
+// AggregateIPMSRecords : joins the blocks of each serviceCode/glbId/netCode into contiguous ranges
+// and returns the minimal cidr cover of each range
+// every address of recs is in exactly one range and Range2CIDRs covers a range exactly,
+// so the coverage of each group does not change
+func AggregateIPMSRecords(recs []*IpmsRecord) ([]*IpmsRecord, error) {
+	sort.Sort(ipmsSort(recs))
 
-	rec.CIDR = fmt.Sprintf("%v/%d", first.IPStart, rec.Prefix)
-	var ip net.IP
-	var err error
-	ip, rec.IPNet, err = net.ParseCIDR(rec.CIDR)
-	rec.IPStart = ip.Mask(rec.IPNet.Mask)
-	rec.IPStartInt = int(binary.BigEndian.Uint32(rec.IPStart))
-	if err != nil {
-		return nil, err
+	var results []*IpmsRecord
+	var head *IpmsRecord
+	var cur IPRange
+	blocks := 0
+	flush := func() error {
+		if head == nil {
+			return nil
+		}
+		var set []*IpmsRecord
+		for _, cidr := range cur.CIDRs() {
+			rec, err := NewRecordFromCIDR(head.ServiceCode, head.GLBID, head.NetCode, head.OfficeCode, cidr)
+			if err != nil {
+				return err
+			}
+			rec.Source = head.Source
+			rec.Line = head.Line
+			rec.Raw = head.Raw
+			set = append(set, rec)
+		}
+		if blocks != len(set) {
+			cilog.Debugf("[%s, %s, %s] merge blocks[%d] to %v", head.ServiceCode, head.GLBID, head.NetCode, blocks, cur.CIDRs())
+		}
+		printLog(set)
+		results = append(results, set...)
+		return nil
 	}
-	cilog.Debugf("[%s, %s, %s] merge [%v, %v] to [%v]", rec.ServiceCode, rec.GLBID, rec.NetCode, first.IPNet, second.IPNet, rec.IPNet)
-	return rec, nil
-}
 
-func (set *contSet) Sum() {
-	if len(*set) <= 1 {
-		return
-	}
-	cilog.Debugf("merge start")
-	var set2 contSet
-	for i := 0; i < len(*set); i++ {
-		rec := (*set)[i]
-		startInt := rec.IPStartInt >> uint(32-rec.Prefix)
-		if startInt%2 != 0 || i == len(*set)-1 || rec.Prefix != (*set)[i+1].Prefix {
-			set2 = append(set2, rec)
+	for _, rec := range recs {
+		r := rec.Range()
+		if head != nil && sameGroup(head, rec) && joinable(cur, r) {
+			if cmp(r.End, cur.End) > 0 {
+				cur.End = r.End
+			}
+			blocks++
 			continue
 		}
-		newRec, err := newParent(rec, (*set)[i+1])
-		if err != nil {
-			set2 = append(set2, rec)
-			continue
+		if err := flush(); err != nil {
+			return nil, err
 		}
-		set2 = append(set2, newRec)
-		i++
-	}
-	cilog.Debugf("merge done")
-
-	if len(*set) == len(set2) {
-		return
-	}
-
-	*set = set2
-	set.Sum()
-}
-
-func (set *contSet) Add(r *IpmsRecord) {
-	*set = append(*set, r)
-}
-
-func (set contSet) IsCont(r *IpmsRecord) bool {
-	if set == nil || len(set) == 0 {
-		return true
-	}
-	if set[0].ServiceCode != r.ServiceCode {
-		return false
+		head, cur, blocks = rec, r, 1
 	}
-	if set[0].GLBID != r.GLBID {
-		return false
-	}
-	if set[0].NetCode != r.NetCode {
-		return false
+	if err := flush(); err != nil {
+		return nil, err
 	}
-	return set[len(set)-1].nextStartIP().String() == r.IPStart.String()
+	return results, nil
 }
@@ -0,0 +1,208 @@
+package ipms
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// oldContSet : the merge of v1.0.2, IPv4 only, kept to check that AggregateIPMSRecords covers the same addresses
+type oldContSet []*IpmsRecord
+
+func (set oldContSet) isCont(r *IpmsRecord) bool {
+	if len(set) == 0 {
+		return true
+	}
+	if !sameGroup(set[0], r) {
+		return false
+	}
+	l := set[len(set)-1]
+	next := uint32(l.IPStartInt) + 1<<uint(32-l.Prefix)
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, next)
+	return ip.String() == r.IPStart.String()
+}
+
+func (set *oldContSet) sum(t *testing.T) {
+	if len(*set) <= 1 {
+		return
+	}
+	var set2 oldContSet
+	for i := 0; i < len(*set); i++ {
+		rec := (*set)[i]
+		startInt := rec.IPStartInt >> uint(32-rec.Prefix)
+		if startInt%2 != 0 || i == len(*set)-1 || rec.Prefix != (*set)[i+1].Prefix {
+			set2 = append(set2, rec)
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(fmt.Sprintf("%v/%d", rec.IPStart, rec.Prefix-1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		parent, err := NewRecordFromCIDR(rec.ServiceCode, rec.GLBID, rec.NetCode, rec.OfficeCode, ipNet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		set2 = append(set2, parent)
+		i++
+	}
+	if len(*set) == len(set2) {
+		return
+	}
+	*set = set2
+	set.sum(t)
+}
+
+func oldMerge(t *testing.T, recs []*IpmsRecord) []*IpmsRecord {
+	sorted := make([]*IpmsRecord, len(recs))
+	copy(sorted, recs)
+	sort.Sort(ipmsSort(sorted))
+
+	var set oldContSet
+	var results []*IpmsRecord
+	for _, rec := range sorted {
+		if !set.isCont(rec) {
+			set.sum(t)
+			results = append(results, set...)
+			set = nil
+		}
+		set = append(set, rec)
+	}
+	set.sum(t)
+	return append(results, set...)
+}
+
+// coverage : merged ranges of each serviceCode/glbId/netCode
+func coverage(recs []*IpmsRecord) map[string]string {
+	ranges := map[string][]IPRange{}
+	for _, rec := range recs {
+		k := rec.ServiceCode + "/" + rec.GLBID + "/" + rec.NetCode
+		ranges[k] = append(ranges[k], rec.Range())
+	}
+	m := map[string]string{}
+	for k, rs := range ranges {
+		var l []string
+		for _, r := range mergeRanges(rs) {
+			l = append(l, r.String())
+		}
+		m[k] = strings.Join(l, ",")
+	}
+	return m
+}
+
+func testRecords(t *testing.T, specs []string) []*IpmsRecord {
+	var recs []*IpmsRecord
+	for _, s := range specs {
+		f := strings.Split(s, " ")
+		_, ipNet, err := net.ParseCIDR(f[3])
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec, err := NewRecordFromCIDR(f[0], f[1], f[2], "R00001", ipNet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recs = append(recs, rec)
+	}
+	return recs
+}
+
+func TestAggregateIPMSRecordsCoverage(t *testing.T) {
+	tests := []struct {
+		name string
+		recs []string // serviceCode glbId netCode cidr
+		want []string // cidrs of the result, nil is not checked
+	}{
+		{
+			name: "/25 followed by /24",
+			recs: []string{"S A 00 10.0.0.128/25", "S A 00 10.0.1.0/24"},
+			want: []string{"10.0.0.128/25", "10.0.1.0/24"},
+		},
+		{
+			name: "two /25 and a /24",
+			recs: []string{"S A 00 10.0.0.0/25", "S A 00 10.0.0.128/25", "S A 00 10.0.1.0/24"},
+			want: []string{"10.0.0.0/23"},
+		},
+		{
+			name: "/24 followed by /25 not aligned",
+			recs: []string{"S A 00 10.0.1.0/24", "S A 00 10.0.2.0/25"},
+			want: []string{"10.0.1.0/24", "10.0.2.0/25"},
+		},
+		{
+			name: "duplicate records",
+			recs: []string{"S A 00 10.0.0.0/24", "S A 00 10.0.0.0/24", "S A 00 10.0.1.0/24"},
+			want: []string{"10.0.0.0/23"},
+		},
+		{
+			name: "nested records",
+			recs: []string{"S A 00 10.0.0.0/23", "S A 00 10.0.1.0/24"},
+			want: []string{"10.0.0.0/23"},
+		},
+		{
+			name: "adjacent ranges of other groups",
+			recs: []string{"S A 00 10.0.0.0/24", "S B 00 10.0.1.0/24", "S A 01 10.0.2.0/24", "T A 00 10.0.3.0/24"},
+			want: []string{"10.0.0.0/24", "10.0.1.0/24", "10.0.2.0/24", "10.0.3.0/24"},
+		},
+		{
+			name: "adjacent v4 and v6 groups",
+			recs: []string{
+				"S A 00 255.255.255.0/24", "S A 00 ::/127", "S A 00 ::2/127",
+				"S A 01 2001:db8::/33", "S A 01 2001:db8:8000::/33", "S B 00 10.0.0.0/25", "S B 00 10.0.0.128/25",
+			},
+			want: []string{"255.255.255.0/24", "::/126", "2001:db8::/32", "10.0.0.0/24"},
+		},
+		{
+			name: "v6 duplicate records",
+			recs: []string{"S A 00 2001:db8::/64", "S A 00 2001:db8::/64", "S A 00 2001:db8:0:1::/64"},
+			want: []string{"2001:db8::/63"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recs := testRecords(t, tt.recs)
+			input := coverage(recs)
+
+			var v4 []*IpmsRecord
+			for _, rec := range recs {
+				if len(rec.IPStart) == net.IPv4len {
+					v4 = append(v4, rec)
+				}
+			}
+			old := coverage(oldMerge(t, v4))
+
+			results, err := AggregateIPMSRecords(testRecords(t, tt.recs))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var resultV4 []*IpmsRecord
+			for _, rec := range results {
+				if len(rec.IPStart) == net.IPv4len {
+					resultV4 = append(resultV4, rec)
+				}
+			}
+
+			if got := coverage(results); fmt.Sprint(got) != fmt.Sprint(input) {
+				t.Errorf("coverage %v, input %v", got, input)
+			}
+			if got := coverage(resultV4); fmt.Sprint(got) != fmt.Sprint(old) {
+				t.Errorf("IPv4 coverage %v, old merge %v", got, old)
+			}
+			if tt.want != nil {
+				var cidrs []string
+				for _, rec := range results {
+					cidrs = append(cidrs, rec.CIDR)
+				}
+				sort.Strings(cidrs)
+				want := append([]string{}, tt.want...)
+				sort.Strings(want)
+				if strings.Join(cidrs, " ") != strings.Join(want, " ") {
+					t.Errorf("cidrs %v, want %v", cidrs, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package ipms
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/castisdev/cilog"
+)
+
+// mapping names of the cache
+const (
+	mappingOfficeNode = "officeNode"
+	mappingNodeGLBID  = "nodeGLBId"
+)
+
+const defaultMappingCacheMaxAge = 24 * time.Hour
+
+// mappingCacheEntry : the list of the last successful response of api
+type mappingCacheEntry struct {
+	API  string          `json:"api"`
+	Time time.Time       `json:"time"`
+	List json.RawMessage `json:"list"`
+}
+
+// mappingCache : contents of mapping-cache-file, by mapping name
+type mappingCache map[string]*mappingCacheEntry
+
+// StaleMapping : a mapping read from the cache because its api failed
+type StaleMapping struct {
+	Name string
+	API  string
+	Time time.Time
+	Err  error
+}
+
+func (m *StaleMapping) String() string {
+	age := time.Since(m.Time).Truncate(time.Second)
+	return fmt.Sprintf("mapping[%s], cache of %s, age[%v], %s failed, %v", m.Name, m.Time.Format(time.RFC3339), age, m.API, m.Err)
+}
+
+// MappingStatus : how GetResolvedMapping got the mapping, Stale is empty when every api answered
+// Files are the mappings read from local files, MultiGLB are the decisions of ResolveMultiGLB
+type MappingStatus struct {
+	Files    []*MappingFile
+	Stale    []*StaleMapping
+	MultiGLB []*MultiGLBDecision
+}
+
+// Lines : lines for the run summary
+func (s *MappingStatus) Lines() []string {
+	var lines []string
+	for _, f := range s.Files {
+		lines = append(lines, f.String())
+	}
+	for _, m := range s.Stale {
+		lines = append(lines, fmt.Sprintf("stale mapping, %v", m))
+	}
+	if len(s.MultiGLB) > 0 {
+		policies := map[string]int{}
+		rejected := 0
+		for _, d := range s.MultiGLB {
+			policies[d.Policy]++
+			if len(d.GLBIDs) == 0 {
+				rejected++
+			}
+		}
+		var l []string
+		for _, p := range []string{MultiGLBAllow, MultiGLBReject, MultiGLBNodePriority, MultiGLBPreferGLB} {
+			if policies[p] > 0 {
+				l = append(l, fmt.Sprintf("%s[%d]", p, policies[p]))
+			}
+		}
+		lines = append(lines, fmt.Sprintf("multi-glb officeCodes[%d], %s, rejected[%d]", len(s.MultiGLB), strings.Join(l, ", "), rejected))
+	}
+	return lines
+}
+
+func (cfg *YmlConfig) mappingCacheMaxAge() (time.Duration, error) {
+	d, err := parseDuration(cfg.MappingCacheMaxAge, defaultMappingCacheMaxAge)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid mapping-cache-max-age, %s", cfg.MappingCacheMaxAge)
+	}
+	return d, nil
+}
+
+func loadMappingCache(filename string) (mappingCache, error) {
+	b, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return mappingCache{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := mappingCache{}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("%s, %v", filename, err)
+	}
+	return c, nil
+}
+
+func saveMappingCache(filename string, c mappingCache) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp := filename + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+// mapping names and the keys of their lists in the api responses
+var mappingListKeys = map[string]string{
+	mappingOfficeNode: "officeNodeMappingList",
+	mappingNodeGLBID:  "nodeGLBIdMappingList",
+}
+
+// getMappingList : gets list of mapping name from api, and keeps it in cache
+// when api fails or its response can not be decoded, list is read from cache if it is not older than maxAge,
+// nil cache is no cache
+func getMappingList(client *Client, name, api string, cache mappingCache, maxAge time.Duration, list interface{}) (*StaleMapping, error) {
+	var resp map[string]json.RawMessage
+	err := client.GetJSON(api, &resp)
+	if err == nil {
+		// a response without the list is a changed api, not an empty mapping
+		key := mappingListKeys[name]
+		raw, ok := resp[key]
+		if ok {
+			err = json.Unmarshal(raw, list)
+		} else {
+			err = fmt.Errorf("%s not exist", key)
+		}
+		if err == nil {
+			if cache != nil {
+				cache[name] = &mappingCacheEntry{API: api, Time: time.Now(), List: raw}
+			}
+			return nil, nil
+		}
+		err = fmt.Errorf("failed to decode response, %v", err)
+	}
+	if cache == nil {
+		return nil, err
+	}
+
+	e := cache[name]
+	if e == nil || e.API != api {
+		return nil, fmt.Errorf("%v, no cache of %s", err, api)
+	}
+	if age := time.Since(e.Time); age > maxAge {
+		return nil, fmt.Errorf("%v, cache of %s is too old, age[%v], mapping-cache-max-age[%v]", err, api, age.Truncate(time.Second), maxAge)
+	}
+	if err := json.Unmarshal(e.List, list); err != nil {
+		return nil, fmt.Errorf("cache of %s, %v", api, err)
+	}
+	stale := &StaleMapping{Name: name, API: api, Time: e.Time, Err: err}
+	cilog.Errorf("failed to get mapping[%s], use stale %v", name, stale)
+	return stale, nil
+}
@@ -0,0 +1,117 @@
+package ipms
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGetMappingListCache(t *testing.T) {
+	cached := json.RawMessage(`[{"officeCode":"R1","nodeCode":"N1"}]`)
+	tests := []struct {
+		name      string
+		status    int
+		body      string
+		cacheAge  time.Duration // 0 is no cache
+		wantErr   bool
+		wantStale bool
+		want      string
+	}{
+		{
+			name:   "api answers",
+			status: http.StatusOK,
+			body:   `{"officeNodeMappingList":[{"officeCode":"R2","nodeCode":"N2"}]}`,
+			want:   "R2/N2",
+		},
+		{
+			name:      "api fails",
+			status:    http.StatusBadRequest,
+			cacheAge:  time.Hour,
+			wantStale: true,
+			want:      "R1/N1",
+		},
+		{
+			name:      "list of 200 can not be decoded",
+			status:    http.StatusOK,
+			body:      `{"officeNodeMappingList":{"officeCode":"R2"}}`,
+			cacheAge:  time.Hour,
+			wantStale: true,
+			want:      "R1/N1",
+		},
+		{
+			name:    "list of 200 can not be decoded without cache",
+			status:  http.StatusOK,
+			body:    `{"officeNodeMappingList":{"officeCode":"R2"}}`,
+			wantErr: true,
+		},
+		{
+			name:      "list not exist",
+			status:    http.StatusOK,
+			body:      `{"result":"ok"}`,
+			cacheAge:  time.Hour,
+			wantStale: true,
+			want:      "R1/N1",
+		},
+		{
+			name:    "list not exist without cache",
+			status:  http.StatusOK,
+			body:    `{"result":"ok"}`,
+			wantErr: true,
+		},
+		{
+			name:   "empty list",
+			status: http.StatusOK,
+			body:   `{"officeNodeMappingList":[]}`,
+		},
+		{
+			name:     "cache too old",
+			status:   http.StatusOK,
+			body:     `{"officeNodeMappingList":"x"}`,
+			cacheAge: 48 * time.Hour,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			}))
+			defer ts.Close()
+
+			cache := mappingCache{}
+			if tt.cacheAge > 0 {
+				cache[mappingOfficeNode] = &mappingCacheEntry{API: ts.URL, Time: time.Now().Add(-tt.cacheAge), List: cached}
+			}
+			var sleeps []time.Duration
+			c := newTestClient(t, nil, &sleeps)
+
+			var list []OfficeNodeMapping
+			stale, err := getMappingList(c, mappingOfficeNode, ts.URL, cache, defaultMappingCacheMaxAge, &list)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err %v, wantErr %v", err, tt.wantErr)
+			}
+			if (stale != nil) != tt.wantStale {
+				t.Errorf("stale %v, wantStale %v", stale, tt.wantStale)
+			}
+			if err != nil {
+				return
+			}
+			var got string
+			for _, m := range list {
+				got += m.OfficeCode + "/" + m.NodeCode
+			}
+			if got != tt.want {
+				t.Errorf("list %s, want %s", got, tt.want)
+			}
+			// a failed response does not replace the cache
+			if e := cache[mappingOfficeNode]; tt.wantStale && string(e.List) != string(cached) {
+				t.Errorf("cache %s, want %s", e.List, cached)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package ipms
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	yaml "gopkg.in/yaml.v1"
+)
+
+// mapping file formats, by extension
+const (
+	mappingFormatCSV  = "csv"
+	mappingFormatYAML = "yaml"
+	mappingFormatJSON = "json"
+)
+
+// MappingFile : a mapping read from a local file instead of its api
+type MappingFile struct {
+	Name   string
+	File   string
+	SHA256 string
+	Rows   int
+}
+
+func (m *MappingFile) String() string {
+	return fmt.Sprintf("mapping[%s], file[%s], sha256[%s], rows[%d]", m.Name, m.File, m.SHA256, m.Rows)
+}
+
+func mappingFileFormat(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return mappingFormatCSV
+	case ".yml", ".yaml":
+		return mappingFormatYAML
+	case ".json":
+		return mappingFormatJSON
+	}
+	return ""
+}
+
+// decodeMappingFile : json or yaml file of the same document as the api response
+func decodeMappingFile(filename string, doc interface{}) error {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if mappingFileFormat(filename) == mappingFormatJSON {
+		err = json.Unmarshal(b, doc)
+	} else {
+		err = yaml.Unmarshal(b, doc)
+	}
+	if err != nil {
+		return fmt.Errorf("%s, %v", filename, err)
+	}
+	return nil
+}
+
+// readMappingCSV : values of columns, the first line is the header
+// each column is a list of header names it may have, compared case-insensitively
+func readMappingCSV(filename string, columns [][]string) ([][]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%s, failed to read header, %v", filename, err)
+	}
+	index := map[string]int{}
+	for i, h := range header {
+		if i == 0 {
+			h = strings.TrimPrefix(h, "\ufeff")
+		}
+		index[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	pos := make([]int, len(columns))
+	for i, names := range columns {
+		pos[i] = -1
+		for _, n := range names {
+			if p, ok := index[strings.ToLower(n)]; ok {
+				pos[i] = p
+				break
+			}
+		}
+		if pos[i] < 0 {
+			return nil, fmt.Errorf("%s, column not exist, %s", filename, strings.Join(names, " or "))
+		}
+	}
+
+	var rows [][]string
+	for line := 2; ; line++ {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s, %v", filename, err)
+		}
+		row := make([]string, len(pos))
+		for i, p := range pos {
+			if p >= len(rec) || strings.TrimSpace(rec[p]) == "" {
+				return nil, fmt.Errorf("%s, line[%d], empty %s", filename, line, columns[i][0])
+			}
+			row[i] = strings.TrimSpace(rec[p])
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// readOfficeNodeFile : csv of nodeCode (or glbNodeCode) and officeCode, or json/yaml of officeNodeMappingList
+func readOfficeNodeFile(filename string) ([]OfficeNodeMapping, error) {
+	if mappingFileFormat(filename) != mappingFormatCSV {
+		var doc struct {
+			List []OfficeNodeMapping `json:"officeNodeMappingList" yaml:"officeNodeMappingList"`
+		}
+		if err := decodeMappingFile(filename, &doc); err != nil {
+			return nil, err
+		}
+		for i, m := range doc.List {
+			if m.OfficeCode == "" || m.NodeCode == "" {
+				return nil, fmt.Errorf("%s, officeNodeMappingList[%d], empty officeCode or nodeCode", filename, i)
+			}
+		}
+		return doc.List, nil
+	}
+
+	rows, err := readMappingCSV(filename, [][]string{{"officeCode"}, {"nodeCode", "glbNodeCode"}})
+	if err != nil {
+		return nil, err
+	}
+	var l []OfficeNodeMapping
+	for _, r := range rows {
+		l = append(l, OfficeNodeMapping{OfficeCode: r[0], NodeCode: r[1]})
+	}
+	return l, nil
+}
+
+// readNodeGLBIDFile : csv of nodeCode (or glbNodeCode), serviceCode and glbId (or regionId), or json/yaml of nodeGLBIdMappingList
+func readNodeGLBIDFile(filename string) ([]NodeGLBIDMapping, error) {
+	if mappingFileFormat(filename) != mappingFormatCSV {
+		var doc struct {
+			List []NodeGLBIDMapping `json:"nodeGLBIdMappingList" yaml:"nodeGLBIdMappingList"`
+		}
+		if err := decodeMappingFile(filename, &doc); err != nil {
+			return nil, err
+		}
+		for i, m := range doc.List {
+			if m.NodeCode == "" || m.ServiceCode == "" || m.GLBID == "" {
+				return nil, fmt.Errorf("%s, nodeGLBIdMappingList[%d], empty nodeCode, serviceCode or glbId", filename, i)
+			}
+		}
+		return doc.List, nil
+	}
+
+	rows, err := readMappingCSV(filename, [][]string{{"nodeCode", "glbNodeCode"}, {"serviceCode"}, {"glbId", "regionId"}})
+	if err != nil {
+		return nil, err
+	}
+	var l []NodeGLBIDMapping
+	for _, r := range rows {
+		l = append(l, NodeGLBIDMapping{NodeCode: r[0], ServiceCode: r[1], GLBID: r[2]})
+	}
+	return l, nil
+}
+
+// newMappingFile : checksum of filename, to tell which version of the mapping was used
+func newMappingFile(name, filename string, rows int) (*MappingFile, error) {
+	sum, err := fileSHA256(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &MappingFile{Name: name, File: filename, SHA256: sum, Rows: rows}, nil
+}
@@ -0,0 +1,208 @@
+package ipms
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadOfficeNodeFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    string // officeCode/nodeCode of the rows
+		wantErr string // empty when the file is valid
+	}{
+		{
+			name:    "csv",
+			file:    "office.csv",
+			content: "nodeCode,officeCode\nN1,R1\n N2 , R2 \n",
+			want:    "R1/N1 R2/N2",
+		},
+		{
+			name:    "csv with bom, glbNodeCode and other case",
+			file:    "office.csv",
+			content: "\ufeffOFFICECODE,x,glbNodeCode\nR1,y,N1\n",
+			want:    "R1/N1",
+		},
+		{
+			name:    "csv of header only",
+			file:    "office.csv",
+			content: "nodeCode,officeCode\n",
+		},
+		{
+			name:    "csv without nodeCode",
+			file:    "office.csv",
+			content: "node,officeCode\nN1,R1\n",
+			wantErr: "column not exist, nodeCode or glbNodeCode",
+		},
+		{
+			name:    "csv of a missing value",
+			file:    "office.csv",
+			content: "nodeCode,officeCode\nN1,R1\nN2\n",
+			wantErr: "line[3], empty officeCode",
+		},
+		{
+			name:    "csv of an empty value",
+			file:    "office.csv",
+			content: "nodeCode,officeCode\n ,R1\n",
+			wantErr: "line[2], empty nodeCode",
+		},
+		{
+			name:    "empty csv",
+			file:    "office.csv",
+			wantErr: "failed to read header, EOF",
+		},
+		{
+			name:    "yaml",
+			file:    "office.yml",
+			content: "officeNodeMappingList:\n  - officeCode: R1\n    nodeCode: N1\n",
+			want:    "R1/N1",
+		},
+		{
+			name:    "json",
+			file:    "office.json",
+			content: `{"officeNodeMappingList":[{"officeCode":"R1","nodeCode":"N1"},{"officeCode":"R2","nodeCode":"N1"}]}`,
+			want:    "R1/N1 R2/N1",
+		},
+		{
+			name:    "json without nodeCode",
+			file:    "office.json",
+			content: `{"officeNodeMappingList":[{"officeCode":"R1","nodeCode":"N1"},{"officeCode":"R2"}]}`,
+			wantErr: "officeNodeMappingList[1], empty officeCode or nodeCode",
+		},
+		{
+			name:    "broken json",
+			file:    "office.json",
+			content: `{"officeNodeMappingList":[`,
+			wantErr: "office.json, unexpected end of JSON input",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeTestFiles(t, map[string]string{tt.file: tt.content})
+			l, err := readOfficeNodeFile(filepath.Join(dir, tt.file))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, m := range l {
+				got = append(got, m.OfficeCode+"/"+m.NodeCode)
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("rows %v, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := readOfficeNodeFile(filepath.Join(t.TempDir(), "none.csv")); err == nil {
+		t.Errorf("missing file, want an error")
+	}
+}
+
+func TestReadNodeGLBIDFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    string // nodeCode/serviceCode/glbId of the rows
+		wantErr string // empty when the file is valid
+	}{
+		{
+			name:    "csv",
+			file:    "glb.csv",
+			content: "nodeCode,serviceCode,glbId\nN1,S,A\nN2,S,B\n",
+			want:    "N1/S/A N2/S/B",
+		},
+		{
+			name:    "csv of glbNodeCode and regionId",
+			file:    "glb.csv",
+			content: "glbNodeCode,serviceCode,regionId\nN1,S,A\n",
+			want:    "N1/S/A",
+		},
+		{
+			name:    "csv without serviceCode",
+			file:    "glb.csv",
+			content: "nodeCode,glbId\nN1,A\n",
+			wantErr: "column not exist, serviceCode",
+		},
+		{
+			name:    "csv of a quote error",
+			file:    "glb.csv",
+			content: "nodeCode,serviceCode,glbId\nN1,\"S,A\n",
+			wantErr: "glb.csv",
+		},
+		{
+			name:    "yaml",
+			file:    "glb.yaml",
+			content: "nodeGLBIdMappingList:\n  - nodeCode: N1\n    serviceCode: S\n    glbId: A\n",
+			want:    "N1/S/A",
+		},
+		{
+			name:    "yaml without glbId",
+			file:    "glb.yaml",
+			content: "nodeGLBIdMappingList:\n  - nodeCode: N1\n    serviceCode: S\n",
+			wantErr: "nodeGLBIdMappingList[0], empty nodeCode, serviceCode or glbId",
+		},
+		{
+			name:    "empty json",
+			file:    "glb.json",
+			wantErr: "glb.json, unexpected end of JSON input",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeTestFiles(t, map[string]string{tt.file: tt.content})
+			l, err := readNodeGLBIDFile(filepath.Join(dir, tt.file))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, m := range l {
+				got = append(got, m.NodeCode+"/"+m.ServiceCode+"/"+m.GLBID)
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("rows %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetMappingTablesFiles(t *testing.T) {
+	dir := writeTestFiles(t, nil)
+	cfg := testImportConfig(t, dir)
+	tables, status, err := GetMappingTables(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables.OfficeNodes) != 2 || len(tables.NodeGLBIDs) != 2 || len(status.Stale) != 0 {
+		t.Errorf("tables %+v, stale %v, want 2 rows of each", tables, status.Stale)
+	}
+
+	sum := sha256.Sum256([]byte("nodeCode,officeCode\nN1,R00001\nN2,R00002\n"))
+	want := fmt.Sprintf("mapping[%s], file[%s], sha256[%s], rows[2]", mappingOfficeNode, cfg.OfficeNodeFile, hex.EncodeToString(sum[:]))
+	if len(status.Files) != 2 || status.Files[0].String() != want {
+		t.Errorf("files %v, want %s first", status.Files, want)
+	}
+
+	cfg.NodeGLBIDFile = filepath.Join(dir, "glb.txt")
+	if _, _, err := GetMappingTables(cfg); err == nil {
+		t.Errorf("missing mapping file, want an error")
+	}
+}
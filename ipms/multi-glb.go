@@ -0,0 +1,203 @@
+package ipms
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/castisdev/cilog"
+)
+
+// multi-glb policies, for an officeCode mapped to several glbIds of the same serviceCode
+const (
+	MultiGLBAllow        = "allow"
+	MultiGLBReject       = "reject"
+	MultiGLBNodePriority = "node-priority"
+	MultiGLBPreferGLB    = "prefer-glb"
+)
+
+// MultiGLBConfig : multi-glb section of the config
+// Offices overrides Policy for some officeCodes, like allow for an office multi-homed on purpose
+// Fallback is used when no candidate is in NodePriority or PreferGLB, allow or reject
+type MultiGLBConfig struct {
+	Policy       string            `yaml:"policy"`
+	NodePriority []string          `yaml:"node-priority"`
+	PreferGLB    []string          `yaml:"prefer-glb"`
+	Fallback     string            `yaml:"fallback"`
+	Offices      map[string]string `yaml:"offices"`
+}
+
+func validMultiGLBPolicy(p string) bool {
+	switch p {
+	case MultiGLBAllow, MultiGLBReject, MultiGLBNodePriority, MultiGLBPreferGLB:
+		return true
+	}
+	return false
+}
+
+func (c *MultiGLBConfig) validate() error {
+	if c.Policy == "" {
+		c.Policy = MultiGLBAllow
+	}
+	if c.Fallback == "" {
+		c.Fallback = MultiGLBReject
+	}
+	if c.Fallback != MultiGLBAllow && c.Fallback != MultiGLBReject {
+		return fmt.Errorf("invalid fallback, %s, must be %s or %s", c.Fallback, MultiGLBAllow, MultiGLBReject)
+	}
+	policies := []string{c.Policy}
+	for office, p := range c.Offices {
+		if !validMultiGLBPolicy(p) {
+			return fmt.Errorf("invalid policy of officeCode[%s], %s", office, p)
+		}
+		policies = append(policies, p)
+	}
+	for _, p := range policies {
+		if !validMultiGLBPolicy(p) {
+			return fmt.Errorf("invalid policy, %s", p)
+		}
+		if p == MultiGLBNodePriority && len(c.NodePriority) == 0 {
+			return errors.New("node-priority not exist")
+		}
+		if p == MultiGLBPreferGLB && len(c.PreferGLB) == 0 {
+			return errors.New("prefer-glb not exist")
+		}
+	}
+	return nil
+}
+
+func (c *MultiGLBConfig) policy(officeCode string) string {
+	if c == nil {
+		return MultiGLBAllow
+	}
+	if p, ok := c.Offices[officeCode]; ok {
+		return p
+	}
+	return c.Policy
+}
+
+// MultiGLBDecision : how the glbIds of an officeCode and a serviceCode were chosen
+// Candidates are glbId(nodeCode), GLBIDs are the glbIds kept, none when rejected
+type MultiGLBDecision struct {
+	OfficeCode  string
+	ServiceCode string
+	Candidates  []string
+	Policy      string
+	GLBIDs      []string
+	Detail      string
+}
+
+func (d *MultiGLBDecision) String() string {
+	return fmt.Sprintf("officeCode[%s], serviceCode[%s], candidates[%s], policy[%s], glbIds[%s], %s",
+		d.OfficeCode, d.ServiceCode, strings.Join(d.Candidates, ","), d.Policy, strings.Join(d.GLBIDs, ","), d.Detail)
+}
+
+// pickFirst : the candidates of the first key that any candidate has
+func pickFirst(l []OfficeGLBIDMapping, keys []string, key func(OfficeGLBIDMapping) string) ([]OfficeGLBIDMapping, string) {
+	for _, k := range keys {
+		var picked []OfficeGLBIDMapping
+		for _, m := range l {
+			if key(m) == k {
+				picked = append(picked, m)
+			}
+		}
+		if len(picked) > 0 {
+			return picked, k
+		}
+	}
+	return nil, ""
+}
+
+// ResolveMultiGLB : applies the multi-glb policy of c to every officeCode that has several glbIds of a serviceCode
+// the same glbId by several nodeCodes is kept once, nil c allows every multi-glb officeCode
+// a rejected serviceCode of an officeCode is not in the result, see MultiGLBRejected for them
+func ResolveMultiGLB(c *MultiGLBConfig, mapping map[string][]OfficeGLBIDMapping) (map[string][]OfficeGLBIDMapping, []*MultiGLBDecision) {
+	var offices []string
+	for o := range mapping {
+		offices = append(offices, o)
+	}
+	sort.Strings(offices)
+
+	var decisions []*MultiGLBDecision
+	resolved := map[string][]OfficeGLBIDMapping{}
+	for _, office := range offices {
+		byServiceCode := map[string][]OfficeGLBIDMapping{}
+		var serviceCodes []string
+		for _, m := range mapping[office] {
+			dup := false
+			for _, n := range byServiceCode[m.ServiceCode] {
+				if n.GLBID == m.GLBID {
+					dup = true
+					break
+				}
+			}
+			if dup {
+				cilog.Debugf("officeCode[%s], serviceCode[%s], glbId[%s] of nodeCode[%s], same glbId by another nodeCode", office, m.ServiceCode, m.GLBID, m.NodeCode)
+				continue
+			}
+			if byServiceCode[m.ServiceCode] == nil {
+				serviceCodes = append(serviceCodes, m.ServiceCode)
+			}
+			byServiceCode[m.ServiceCode] = append(byServiceCode[m.ServiceCode], m)
+		}
+
+		for _, sc := range serviceCodes {
+			l := byServiceCode[sc]
+			if len(l) == 1 {
+				resolved[office] = append(resolved[office], l...)
+				continue
+			}
+
+			d := &MultiGLBDecision{OfficeCode: office, ServiceCode: sc, Policy: c.policy(office)}
+			for _, m := range l {
+				d.Candidates = append(d.Candidates, fmt.Sprintf("%s(%s)", m.GLBID, m.NodeCode))
+			}
+			var kept []OfficeGLBIDMapping
+			switch d.Policy {
+			case MultiGLBAllow:
+				kept = l
+				d.Detail = "multi-homed"
+			case MultiGLBReject:
+				d.Detail = "rejected, lines of the serviceCode are not imported"
+			case MultiGLBNodePriority, MultiGLBPreferGLB:
+				var k string
+				if d.Policy == MultiGLBNodePriority {
+					kept, k = pickFirst(l, c.NodePriority, func(m OfficeGLBIDMapping) string { return m.NodeCode })
+					d.Detail = fmt.Sprintf("by nodeCode[%s]", k)
+				} else {
+					kept, k = pickFirst(l, c.PreferGLB, func(m OfficeGLBIDMapping) string { return m.GLBID })
+					d.Detail = fmt.Sprintf("by glbId[%s]", k)
+				}
+				if kept == nil {
+					if c.Fallback == MultiGLBAllow {
+						kept = l
+					}
+					d.Detail = fmt.Sprintf("no candidate in %s, fallback[%s]", d.Policy, c.Fallback)
+				}
+			}
+			for _, m := range kept {
+				d.GLBIDs = append(d.GLBIDs, m.GLBID)
+			}
+			if len(kept) == 0 {
+				cilog.Warningf("multi-glb, %v", d)
+			} else {
+				cilog.Infof("multi-glb, %v", d)
+			}
+			resolved[office] = append(resolved[office], kept...)
+			decisions = append(decisions, d)
+		}
+	}
+	return resolved, decisions
+}
+
+// MultiGLBRejected : the serviceCodes of each officeCode that decisions rejected
+func MultiGLBRejected(decisions []*MultiGLBDecision) map[string][]string {
+	m := map[string][]string{}
+	for _, d := range decisions {
+		if len(d.GLBIDs) == 0 {
+			m[d.OfficeCode] = append(m[d.OfficeCode], d.ServiceCode)
+		}
+	}
+	return m
+}
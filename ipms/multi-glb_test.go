@@ -0,0 +1,119 @@
+package ipms
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveMultiGLB(t *testing.T) {
+	mapping := map[string][]OfficeGLBIDMapping{
+		"R1": {
+			{OfficeCode: "R1", ServiceCode: "S", GLBID: "A", NodeCode: "N1"},
+			{OfficeCode: "R1", ServiceCode: "S", GLBID: "B", NodeCode: "N2"},
+			{OfficeCode: "R1", ServiceCode: "T", GLBID: "C", NodeCode: "N2"},
+		},
+		"R2": {
+			{OfficeCode: "R2", ServiceCode: "S", GLBID: "A", NodeCode: "N1"},
+			{OfficeCode: "R2", ServiceCode: "S", GLBID: "A", NodeCode: "N3"},
+		},
+	}
+	tests := []struct {
+		name      string
+		cfg       *MultiGLBConfig
+		want      string // glbIds of R1
+		rejected  string // serviceCodes of R1 rejected
+		decisions int
+	}{
+		{name: "nil config allows", cfg: nil, want: "S/A S/B T/C", decisions: 1},
+		{name: "reject", cfg: &MultiGLBConfig{Policy: MultiGLBReject}, want: "T/C", rejected: "S", decisions: 1},
+		{name: "node-priority", cfg: &MultiGLBConfig{Policy: MultiGLBNodePriority, NodePriority: []string{"N2"}}, want: "S/B T/C", decisions: 1},
+		{name: "prefer-glb fallback reject", cfg: &MultiGLBConfig{Policy: MultiGLBPreferGLB, PreferGLB: []string{"Z"}}, want: "T/C", rejected: "S", decisions: 1},
+		{name: "prefer-glb fallback allow", cfg: &MultiGLBConfig{Policy: MultiGLBPreferGLB, PreferGLB: []string{"Z"}, Fallback: MultiGLBAllow}, want: "S/A S/B T/C", decisions: 1},
+		{name: "office policy", cfg: &MultiGLBConfig{Policy: MultiGLBReject, Offices: map[string]string{"R1": MultiGLBAllow}}, want: "S/A S/B T/C", decisions: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.cfg != nil {
+				if err := tt.cfg.validate(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			resolved, decisions := ResolveMultiGLB(tt.cfg, mapping)
+			var got string
+			for i, m := range resolved["R1"] {
+				if i > 0 {
+					got += " "
+				}
+				got += m.ServiceCode + "/" + m.GLBID
+			}
+			if got != tt.want {
+				t.Errorf("R1 %s, want %s", got, tt.want)
+			}
+			for _, l := range resolved {
+				for _, m := range l {
+					if m.GLBID == "" {
+						t.Errorf("%v, empty glbId in the mapping", m)
+					}
+				}
+			}
+			if got := strings.Join(MultiGLBRejected(decisions)["R1"], " "); got != tt.rejected {
+				t.Errorf("rejected serviceCodes of R1 %s, want %s", got, tt.rejected)
+			}
+			if len(decisions) != tt.decisions {
+				t.Errorf("decisions %v, want %d", decisions, tt.decisions)
+			}
+			// the same glbId by two nodeCodes is not a multi-glb
+			if r2 := resolved["R2"]; len(r2) != 1 || r2[0].GLBID != "A" {
+				t.Errorf("R2 %v, want glbId A once", r2)
+			}
+		})
+	}
+}
+
+func TestLoadImportMultiGLBRejected(t *testing.T) {
+	// R00003 has glbIds A and B of S, and C of T
+	dir := writeTestFiles(t, map[string]string{
+		"in.csv": "10.0.0.0|10.0.0.255|a|R00003|a|x|00|x\n" +
+			"10.0.1.0|10.0.1.255|a|R00001|a|x|00|x\n",
+	})
+	cfg := testImportConfig(t, dir)
+	for name, content := range map[string]string{
+		"office.csv": "nodeCode,officeCode\nN1,R00001\nN1,R00003\nN2,R00003\n",
+		"glb.csv":    "nodeCode,serviceCode,glbId\nN1,S,A\nN2,S,B\nN2,T,C\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg.MultiGLB = &MultiGLBConfig{Policy: MultiGLBReject}
+	if err := cfg.MultiGLB.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := LoadImport(cfg, "ipms-v2", []string{filepath.Join(dir, "in.csv")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for office, l := range r.Mapping {
+		for _, m := range l {
+			if m.GLBID == "" {
+				t.Errorf("officeCode[%s], serviceCode[%s], empty glbId in the mapping", office, m.ServiceCode)
+			}
+		}
+	}
+	var got []string
+	for _, rec := range r.Records {
+		got = append(got, rec.OfficeCode+"/"+rec.ServiceCode+"/"+rec.GLBID)
+	}
+	if strings.Join(got, " ") != "R00003/T/C R00001/S/A" {
+		t.Errorf("records %v, want R00003/T/C R00001/S/A", got)
+	}
+	st := r.InputStats.Stats[0]
+	rejects := r.InputStats.Rejects()
+	if len(rejects) != 1 || rejects[0].Reason != RejectMultiGLBRejected || rejects[0].Line != 1 || st.MultiGLBRejectedLines != 1 {
+		t.Errorf("rejects %v, multi-glb rejected lines[%d], want line[1] as %s", rejects, st.MultiGLBRejectedLines, RejectMultiGLBRejected)
+	}
+}
@@ -0,0 +1,321 @@
+package ipms
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/castisdev/cilog"
+)
+
+// override actions
+const (
+	OverrideAssign  = "assign"
+	OverrideExclude = "exclude"
+)
+
+// OverrideRule : a rule of override-file, applied to the records of the input before conflicts and merge
+// assign : the addresses of CIDR of ServiceCode get GLBID and/or NetCode,
+// and the addresses that no record has are added when both GLBID and NetCode are set
+// exclude : the addresses of CIDR are removed from ServiceCode, or from every serviceCode when it is empty
+// Expiry is a date like 2026-12-31, the rule is not applied after that day, empty never expires
+type OverrideRule struct {
+	CIDR        string `json:"cidr" yaml:"cidr"`
+	ServiceCode string `json:"serviceCode" yaml:"serviceCode"`
+	GLBID       string `json:"glbId" yaml:"glbId"`
+	NetCode     string `json:"netCode" yaml:"netCode"`
+	Action      string `json:"action" yaml:"action"`
+	Expiry      string `json:"expiry" yaml:"expiry"`
+	Comment     string `json:"comment" yaml:"comment"`
+
+	line   int
+	block  IPRange
+	expiry time.Time
+}
+
+func (r *OverrideRule) String() string {
+	s := fmt.Sprintf("line[%d], %s, cidr[%s], serviceCode[%s]", r.line, r.Action, r.CIDR, r.ServiceCode)
+	if r.Action == OverrideAssign {
+		s += fmt.Sprintf(", glbId[%s], netCode[%s]", r.GLBID, r.NetCode)
+	}
+	if r.Expiry != "" {
+		s += fmt.Sprintf(", expiry[%s]", r.Expiry)
+	}
+	return s
+}
+
+// parseExpiry : a date is valid until the end of the day, in local time
+func parseExpiry(s string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t.AddDate(0, 0, 1), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func (r *OverrideRule) validate() error {
+	r.Action = strings.ToLower(strings.TrimSpace(r.Action))
+	switch r.Action {
+	case OverrideAssign:
+		if r.ServiceCode == "" {
+			return errors.New("assign needs serviceCode")
+		}
+		if r.GLBID == "" && r.NetCode == "" {
+			return errors.New("assign needs glbId or netCode")
+		}
+	case OverrideExclude:
+		if r.GLBID != "" || r.NetCode != "" {
+			return errors.New("exclude does not use glbId and netCode")
+		}
+	default:
+		return fmt.Errorf("invalid action, %s, must be %s or %s", r.Action, OverrideAssign, OverrideExclude)
+	}
+	_, ipNet, err := net.ParseCIDR(r.CIDR)
+	if err != nil {
+		return fmt.Errorf("invalid cidr, %s", r.CIDR)
+	}
+	start := normalizeIP(ipNet.IP)
+	r.block = IPRange{start, last(start, ipNet.Mask)}
+	if r.Expiry != "" {
+		if r.expiry, err = parseExpiry(r.Expiry); err != nil {
+			return fmt.Errorf("invalid expiry, %s", r.Expiry)
+		}
+	}
+	return nil
+}
+
+// readOverrideCSV : the first line is the header of cidr, serviceCode, glbId, netCode, action, expiry and comment
+// cidr and action are required, the other columns may be omitted
+func readOverrideCSV(filename string) ([]*OverrideRule, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.Comment = '#'
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%s, failed to read header, %v", filename, err)
+	}
+	index := map[string]int{}
+	for i, h := range header {
+		if i == 0 {
+			h = strings.TrimPrefix(h, "\ufeff")
+		}
+		index[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	for _, c := range []string{"cidr", "action"} {
+		if _, ok := index[c]; !ok {
+			return nil, fmt.Errorf("%s, column not exist, %s", filename, c)
+		}
+	}
+
+	var rules []*OverrideRule
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s, %v", filename, err)
+		}
+		line, _ := r.FieldPos(0)
+		field := func(name string) string {
+			if i, ok := index[strings.ToLower(name)]; ok && i < len(rec) {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+		rules = append(rules, &OverrideRule{
+			CIDR:        field("cidr"),
+			ServiceCode: field("serviceCode"),
+			GLBID:       field("glbId"),
+			NetCode:     field("netCode"),
+			Action:      field("action"),
+			Expiry:      field("expiry"),
+			Comment:     field("comment"),
+			line:        line,
+		})
+	}
+	return rules, nil
+}
+
+// LoadOverrides : rules of override-file, csv, or yaml/json of an overrides list
+func LoadOverrides(filename string) ([]*OverrideRule, error) {
+	var rules []*OverrideRule
+	switch mappingFileFormat(filename) {
+	case mappingFormatCSV:
+		var err error
+		if rules, err = readOverrideCSV(filename); err != nil {
+			return nil, err
+		}
+	case mappingFormatYAML, mappingFormatJSON:
+		var doc struct {
+			Overrides []*OverrideRule `json:"overrides" yaml:"overrides"`
+		}
+		if err := decodeMappingFile(filename, &doc); err != nil {
+			return nil, err
+		}
+		rules = doc.Overrides
+		for i, r := range rules {
+			r.line = i + 1
+		}
+	default:
+		return nil, fmt.Errorf("invalid override file, %s, must be .csv, .yml, .yaml or .json", filename)
+	}
+	for _, r := range rules {
+		if err := r.validate(); err != nil {
+			return nil, fmt.Errorf("%s, line[%d], %v", filename, r.line, err)
+		}
+	}
+	return rules, nil
+}
+
+// OverrideResult : effect of a rule, Records is the number of records it changed or removed
+// Added is the number of netMasks it added for the addresses that no record had
+type OverrideResult struct {
+	Rule    *OverrideRule
+	Expired bool
+	Records int
+	Added   int
+}
+
+func (r *OverrideResult) String() string {
+	if r.Expired {
+		return fmt.Sprintf("override, %v, expired, not applied", r.Rule)
+	}
+	return fmt.Sprintf("override, %v, records[%d], added netMasks[%d]", r.Rule, r.Records, r.Added)
+}
+
+// OverrideAdded : number of records added by results, they are not records of the input
+func OverrideAdded(results []*OverrideResult) int {
+	n := 0
+	for _, r := range results {
+		n += r.Added
+	}
+	return n
+}
+
+// intersectRange : overlapped part of a and b
+func intersectRange(a, b IPRange) (IPRange, bool) {
+	if len(a.Start) != len(b.Start) || cmp(a.End, b.Start) < 0 || cmp(b.End, a.Start) < 0 {
+		return IPRange{}, false
+	}
+	r := a
+	if cmp(b.Start, r.Start) > 0 {
+		r.Start = b.Start
+	}
+	if cmp(b.End, r.End) < 0 {
+		r.End = b.End
+	}
+	return r, true
+}
+
+// splitRecord : records of the same values as rec for the addresses of ranges
+func splitRecord(rec *IpmsRecord, ranges []IPRange, glbID, netCode string) ([]*IpmsRecord, error) {
+	var l []*IpmsRecord
+	for _, r := range ranges {
+		for _, cidr := range r.CIDRs() {
+			newRec, err := NewRecordFromCIDR(rec.ServiceCode, glbID, netCode, rec.OfficeCode, cidr)
+			if err != nil {
+				return nil, err
+			}
+			newRec.Source = rec.Source
+			newRec.Line = rec.Line
+			newRec.Raw = rec.Raw
+			l = append(l, newRec)
+		}
+	}
+	return l, nil
+}
+
+// ApplyOverrides : applies rules in order to recs, a later rule applies to the result of the earlier rules
+// source is the name of the override file, for the added records
+func ApplyOverrides(rules []*OverrideRule, recs []*IpmsRecord, source string, now time.Time) ([]*IpmsRecord, []*OverrideResult, error) {
+	var results []*OverrideResult
+	for _, rule := range rules {
+		res := &OverrideResult{Rule: rule}
+		results = append(results, res)
+		if !rule.expiry.IsZero() && !now.Before(rule.expiry) {
+			res.Expired = true
+			cilog.Warningf("%v", res)
+			continue
+		}
+
+		var applied []*IpmsRecord
+		var covered []IPRange
+		for _, rec := range recs {
+			if rule.ServiceCode != "" && rec.ServiceCode != rule.ServiceCode {
+				applied = append(applied, rec)
+				continue
+			}
+			inside, ok := intersectRange(rec.Range(), rule.block)
+			if !ok {
+				applied = append(applied, rec)
+				continue
+			}
+			res.Records++
+
+			outside, err := splitRecord(rec, subtractRanges([]IPRange{rec.Range()}, []IPRange{rule.block}), rec.GLBID, rec.NetCode)
+			if err != nil {
+				return nil, nil, err
+			}
+			applied = append(applied, outside...)
+			if rule.Action == OverrideExclude {
+				continue
+			}
+
+			glbID, netCode := rec.GLBID, rec.NetCode
+			if rule.GLBID != "" {
+				glbID = rule.GLBID
+			}
+			if rule.NetCode != "" {
+				netCode = rule.NetCode
+			}
+			assigned, err := splitRecord(rec, []IPRange{inside}, glbID, netCode)
+			if err != nil {
+				return nil, nil, err
+			}
+			applied = append(applied, assigned...)
+			covered = append(covered, inside)
+		}
+
+		if rule.Action == OverrideAssign && rule.GLBID != "" && rule.NetCode != "" {
+			for _, r := range subtractRanges([]IPRange{rule.block}, mergeRanges(covered)) {
+				for _, cidr := range r.CIDRs() {
+					rec, err := NewRecordFromCIDR(rule.ServiceCode, rule.GLBID, rule.NetCode, "", cidr)
+					if err != nil {
+						return nil, nil, err
+					}
+					rec.Source = source
+					rec.Line = rule.line
+					rec.Raw = rule.String()
+					applied = append(applied, rec)
+					res.Added++
+				}
+			}
+		}
+		recs = applied
+		cilog.Infof("%v", res)
+	}
+	return recs, results, nil
+}
+
+// LoadAndApplyOverrides : applies override-file of cfg to recs, nothing when override-file does not exist
+func LoadAndApplyOverrides(cfg *YmlConfig, recs []*IpmsRecord) ([]*IpmsRecord, []*OverrideResult, error) {
+	if cfg.OverrideFile == "" {
+		return recs, nil, nil
+	}
+	rules, err := LoadOverrides(cfg.OverrideFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ApplyOverrides(rules, recs, cfg.OverrideFile, time.Now())
+}
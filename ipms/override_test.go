@@ -0,0 +1,193 @@
+package ipms
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testRange : "10.0.0.0-10.0.0.255"
+func testRange(s string) IPRange {
+	f := strings.Split(s, "-")
+	return IPRange{normalizeIP(net.ParseIP(f[0])), normalizeIP(net.ParseIP(f[1]))}
+}
+
+func TestIntersectRange(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want string // empty when they do not overlap
+	}{
+		{"10.0.0.0-10.0.0.255", "10.0.0.128-10.0.1.255", "10.0.0.128-10.0.0.255"},
+		{"10.0.0.128-10.0.1.255", "10.0.0.0-10.0.0.255", "10.0.0.128-10.0.0.255"},
+		{"10.0.0.0-10.0.3.255", "10.0.1.0-10.0.1.255", "10.0.1.0-10.0.1.255"},
+		{"10.0.0.0-10.0.0.255", "10.0.0.255-10.0.1.255", "10.0.0.255-10.0.0.255"},
+		{"10.0.0.0-10.0.0.255", "10.0.1.0-10.0.1.255", ""},
+		{"0.0.0.0-0.0.0.255", "::-::ff", ""},
+		{"2001:db8::-2001:db8::ffff", "2001:db8::8000-2001:db8:1::", "2001:db8::8000-2001:db8::ffff"},
+	}
+	for _, tt := range tests {
+		r, ok := intersectRange(testRange(tt.a), testRange(tt.b))
+		got := ""
+		if ok {
+			got = r.String()
+		}
+		if got != tt.want {
+			t.Errorf("intersectRange(%s, %s) %s, want %s", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSplitRecord(t *testing.T) {
+	rec := testRecords(t, []string{"S A 00 10.0.0.0/24"})[0]
+	rec.Source, rec.Line, rec.Raw = "in.csv", 3, "raw"
+
+	l, err := splitRecord(rec, []IPRange{testRange("10.0.0.0-10.0.0.127"), testRange("10.0.0.192-10.0.0.254")}, "B", "01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cidrs []string
+	for _, r := range l {
+		cidrs = append(cidrs, r.CIDR)
+		if r.ServiceCode != "S" || r.GLBID != "B" || r.NetCode != "01" || r.OfficeCode != "R00001" {
+			t.Errorf("%s, serviceCode[%s], glbId[%s], netCode[%s], officeCode[%s]", r.CIDR, r.ServiceCode, r.GLBID, r.NetCode, r.OfficeCode)
+		}
+		if r.Source != "in.csv" || r.Line != 3 || r.Raw != "raw" {
+			t.Errorf("%s, source[%s], line[%d], raw[%s], want those of rec", r.CIDR, r.Source, r.Line, r.Raw)
+		}
+	}
+	want := "10.0.0.0/25 10.0.0.192/27 10.0.0.224/28 10.0.0.240/29 10.0.0.248/30 10.0.0.252/31 10.0.0.254/32"
+	if got := strings.Join(cidrs, " "); got != want {
+		t.Errorf("cidrs %s, want %s", got, want)
+	}
+}
+
+func TestApplyOverrides(t *testing.T) {
+	day := time.Date(2026, 10, 17, 0, 0, 0, 0, time.Local)
+	tests := []struct {
+		name    string
+		rules   []*OverrideRule
+		recs    []string // serviceCode glbId netCode cidr
+		now     time.Time
+		want    []string
+		results []string // records/added of each rule, or expired
+	}{
+		{
+			name:    "assign partial overlap",
+			rules:   []*OverrideRule{{CIDR: "10.0.0.128/25", ServiceCode: "S", GLBID: "B", Action: OverrideAssign}},
+			recs:    []string{"S A 00 10.0.0.0/24", "T A 00 10.0.0.0/24"},
+			want:    []string{"S A 00 10.0.0.0/25", "S B 00 10.0.0.128/25", "T A 00 10.0.0.0/24"},
+			results: []string{"1/0"},
+		},
+		{
+			name:    "assign netCode only keeps glbId",
+			rules:   []*OverrideRule{{CIDR: "10.0.0.0/25", ServiceCode: "S", NetCode: "09", Action: OverrideAssign}},
+			recs:    []string{"S A 00 10.0.0.0/24"},
+			want:    []string{"S A 00 10.0.0.128/25", "S A 09 10.0.0.0/25"},
+			results: []string{"1/0"},
+		},
+		{
+			name:    "assign adds the addresses that no record has",
+			rules:   []*OverrideRule{{CIDR: "10.0.0.0/23", ServiceCode: "S", GLBID: "B", NetCode: "01", Action: OverrideAssign}},
+			recs:    []string{"S A 00 10.0.0.0/24", "T A 00 10.0.1.0/24"},
+			want:    []string{"S B 01 10.0.0.0/24", "S B 01 10.0.1.0/24", "T A 00 10.0.1.0/24"},
+			results: []string{"1/1"},
+		},
+		{
+			name:    "assign without netCode adds nothing",
+			rules:   []*OverrideRule{{CIDR: "10.0.0.0/23", ServiceCode: "S", GLBID: "B", Action: OverrideAssign}},
+			recs:    []string{"S A 00 10.0.0.0/24"},
+			want:    []string{"S B 00 10.0.0.0/24"},
+			results: []string{"1/0"},
+		},
+		{
+			name:    "exclude without serviceCode",
+			rules:   []*OverrideRule{{CIDR: "10.0.0.0/25", Action: OverrideExclude}},
+			recs:    []string{"S A 00 10.0.0.0/24", "T B 00 10.0.0.0/24", "T B 00 10.0.1.0/24"},
+			want:    []string{"S A 00 10.0.0.128/25", "T B 00 10.0.0.128/25", "T B 00 10.0.1.0/24"},
+			results: []string{"2/0"},
+		},
+		{
+			name:    "exclude of a serviceCode",
+			rules:   []*OverrideRule{{CIDR: "10.0.0.0/24", ServiceCode: "T", Action: OverrideExclude}},
+			recs:    []string{"S A 00 10.0.0.0/24", "T B 00 10.0.0.0/23"},
+			want:    []string{"S A 00 10.0.0.0/24", "T B 00 10.0.1.0/24"},
+			results: []string{"1/0"},
+		},
+		{
+			name: "later rule applies to the result of earlier rule",
+			rules: []*OverrideRule{
+				{CIDR: "10.0.0.0/24", ServiceCode: "S", GLBID: "B", Action: OverrideAssign},
+				{CIDR: "10.0.0.0/25", ServiceCode: "S", Action: OverrideExclude},
+			},
+			recs:    []string{"S A 00 10.0.0.0/24"},
+			want:    []string{"S B 00 10.0.0.128/25"},
+			results: []string{"1/0", "1/0"},
+		},
+		{
+			name:    "applied on the last second of expiry",
+			rules:   []*OverrideRule{{CIDR: "10.0.0.0/24", Action: OverrideExclude, Expiry: "2026-10-17"}},
+			recs:    []string{"S A 00 10.0.0.0/24"},
+			now:     day.Add(24*time.Hour - time.Second),
+			want:    nil,
+			results: []string{"1/0"},
+		},
+		{
+			name:    "expired on the next day",
+			rules:   []*OverrideRule{{CIDR: "10.0.0.0/24", Action: OverrideExclude, Expiry: "2026-10-17"}},
+			recs:    []string{"S A 00 10.0.0.0/24"},
+			now:     day.Add(24 * time.Hour),
+			want:    []string{"S A 00 10.0.0.0/24"},
+			results: []string{"expired"},
+		},
+		{
+			name:    "other address family",
+			rules:   []*OverrideRule{{CIDR: "2001:db8::/32", Action: OverrideExclude}},
+			recs:    []string{"S A 00 10.0.0.0/24", "S A 00 2001:db8::/48"},
+			want:    []string{"S A 00 10.0.0.0/24"},
+			results: []string{"1/0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, r := range tt.rules {
+				r.line = i + 1
+				if err := r.validate(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			now := tt.now
+			if now.IsZero() {
+				now = day
+			}
+			recs, results, err := ApplyOverrides(tt.rules, testRecords(t, tt.recs), "ov.csv", now)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, rec := range recs {
+				got = append(got, strings.Join([]string{rec.ServiceCode, rec.GLBID, rec.NetCode, rec.CIDR}, " "))
+			}
+			sort.Strings(got)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("records %q, want %q", got, tt.want)
+			}
+
+			var gotResults []string
+			for _, r := range results {
+				if r.Expired {
+					gotResults = append(gotResults, "expired")
+					continue
+				}
+				gotResults = append(gotResults, fmt.Sprintf("%d/%d", r.Records, r.Added))
+			}
+			if strings.Join(gotResults, " ") != strings.Join(tt.results, " ") {
+				t.Errorf("results %v, want %v", gotResults, tt.results)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package ipms
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/castisdev/cilog"
+)
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// CreateOutput : "-" means stdout
+func CreateOutput(filename string) (io.WriteCloser, error) {
+	if filename == "-" || filename == "" {
+		return nopCloser{os.Stdout}, nil
+	}
+	return os.Create(filename)
+}
+
+// WriteJSON : encodes v the same way it is posted, pretty indents it
+func WriteJSON(w io.Writer, v interface{}, pretty bool) error {
+	enc := json.NewEncoder(w)
+	if pretty {
+		enc.SetIndent("", "  ")
+	}
+	return enc.Encode(v)
+}
+
+// DryRunIPMSRecords : writes the body ImportIPMSRecords would post, instead of posting it
+// returns the api the body would be posted to
+func DryRunIPMSRecords(cfg *YmlConfig, infos []*ServiceCodeInfo, w io.Writer, pretty bool) (string, error) {
+	api, body, err := importPayload(cfg, infos)
+	if err != nil {
+		return "", err
+	}
+	if body == nil {
+		body = []*ServiceCodeDelta{}
+	}
+	return api, WriteJSON(w, body, pretty)
+}
+
+// RunSummary : statistics of a run
+// Mapping and Inputs are nil when they are not known
+// OverrideRecords are the records added by override-file, they are not in InputRecords
+type RunSummary struct {
+	InputRecords    int
+	OverrideRecords int
+	Mapping         *MappingStatus
+	Inputs          *InputStats
+	Overrides       []*OverrideResult
+	Infos           []*ServiceCodeInfo
+	Notes           []string
+}
+
+// Notef : adds a line to the summary
+func (s *RunSummary) Notef(format string, a ...interface{}) {
+	s.Notes = append(s.Notes, fmt.Sprintf(format, a...))
+}
+
+// Lines :
+func (s *RunSummary) Lines() []string {
+	var lines []string
+	if s.Mapping != nil {
+		lines = append(lines, s.Mapping.Lines()...)
+	}
+	if s.Inputs != nil {
+		lines = append(lines, s.Inputs.Lines()...)
+	}
+	for _, o := range s.Overrides {
+		lines = append(lines, o.String())
+	}
+	if s.OverrideRecords > 0 {
+		lines = append(lines, fmt.Sprintf("input records[%d], override records[%d]", s.InputRecords, s.OverrideRecords))
+	} else {
+		lines = append(lines, fmt.Sprintf("input records[%d]", s.InputRecords))
+	}
+	glbs, netMasks := 0, 0
+	for _, sc := range s.Infos {
+		n := 0
+		for _, glb := range sc.GLBIDNetMaskList {
+			n += len(glb.NetMaskAddressList)
+		}
+		lines = append(lines, fmt.Sprintf("serviceCode[%s], glbIds[%d], netMasks[%d]", sc.ServiceCode, len(sc.GLBIDNetMaskList), n))
+		for _, glb := range sc.GLBIDNetMaskList {
+			lines = append(lines, fmt.Sprintf("  glbId[%s], netMasks[%d]", glb.GLBID, len(glb.NetMaskAddressList)))
+		}
+		glbs += len(sc.GLBIDNetMaskList)
+		netMasks += n
+	}
+	lines = append(lines, fmt.Sprintf("total serviceCodes[%d], glbIds[%d], netMasks[%d]", len(s.Infos), glbs, netMasks))
+	return append(lines, s.Notes...)
+}
+
+// Print :
+func (s *RunSummary) Print(w io.Writer) {
+	for _, l := range s.Lines() {
+		fmt.Fprintln(w, l)
+	}
+}
+
+// Log :
+func (s *RunSummary) Log() {
+	for _, l := range s.Lines() {
+		cilog.Infof("summary, %s", l)
+	}
+}
+
+// WriteDryRun : writes the post body of DryRunIPMSRecords to output and prints the summary,
+// the summary goes to stderr when the post body goes to stdout
+func WriteDryRun(cfg *YmlConfig, infos []*ServiceCodeInfo, summary *RunSummary, output string, pretty bool) error {
+	w, err := CreateOutput(output)
+	if err != nil {
+		return err
+	}
+	api, err := DryRunIPMSRecords(cfg, infos, w, pretty)
+	if err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if output == "-" {
+		out = os.Stderr
+	}
+	fmt.Fprintf(out, "dry-run, POST %s, not posted\n", api)
+	summary.Print(out)
+	cilog.Infof("success to dry-run, POST %s, output[%s]", api, output)
+	return nil
+}
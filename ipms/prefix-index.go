@@ -0,0 +1,80 @@
+package ipms
+
+import (
+	"net"
+	"sort"
+)
+
+type trieNode struct {
+	child [2]*trieNode
+	recs  []*IpmsRecord
+}
+
+// PrefixIndex : binary prefix trie of IpmsRecord for longest prefix match
+type PrefixIndex struct {
+	v4 *trieNode
+	v6 *trieNode
+}
+
+// NewPrefixIndex :
+func NewPrefixIndex(recs []*IpmsRecord) *PrefixIndex {
+	idx := &PrefixIndex{&trieNode{}, &trieNode{}}
+	for _, rec := range recs {
+		idx.Insert(rec)
+	}
+	return idx
+}
+
+func (idx *PrefixIndex) root(ip net.IP) *trieNode {
+	if len(ip) == net.IPv4len {
+		return idx.v4
+	}
+	return idx.v6
+}
+
+// Insert :
+func (idx *PrefixIndex) Insert(rec *IpmsRecord) {
+	n := idx.root(rec.IPStart)
+	for i := 0; i < rec.Prefix; i++ {
+		b := bitAt(rec.IPStart, i)
+		if n.child[b] == nil {
+			n.child[b] = &trieNode{}
+		}
+		n = n.child[b]
+	}
+	n.recs = append(n.recs, rec)
+}
+
+// Lookup : the longest matching records of each service code
+// serviceCode "" means every service code
+func (idx *PrefixIndex) Lookup(ip net.IP, serviceCode string) []*IpmsRecord {
+	ip = normalizeIP(ip)
+	if ip == nil {
+		return nil
+	}
+
+	best := map[string][]*IpmsRecord{}
+	n := idx.root(ip)
+	for i := 0; n != nil; i++ {
+		found := map[string][]*IpmsRecord{}
+		for _, rec := range n.recs {
+			if serviceCode == "" || rec.ServiceCode == serviceCode {
+				found[rec.ServiceCode] = append(found[rec.ServiceCode], rec)
+			}
+		}
+		for sc, recs := range found {
+			best[sc] = recs
+		}
+		if i == len(ip)*8 {
+			break
+		}
+		n = n.child[bitAt(ip, i)]
+	}
+
+	var results []*IpmsRecord
+	for _, recs := range best {
+		results = append(results, recs...)
+	}
+	sort.Sort(ipmsSort(results))
+	return results
+}
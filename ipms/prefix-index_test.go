@@ -0,0 +1,51 @@
+package ipms
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestPrefixIndexLookup(t *testing.T) {
+	idx := NewPrefixIndex(testRecords(t, []string{
+		"S A 00 10.0.0.0/16",
+		"S B 00 10.0.1.0/24",
+		"S C 01 10.0.1.0/24",
+		"T D 00 10.0.0.0/8",
+		"S E 00 0.0.0.0/0",
+		"S F 00 2001:db8::/32",
+		"S G 00 2001:db8:1::/48",
+	}))
+	tests := []struct {
+		ip          string
+		serviceCode string
+		want        string // serviceCode/glbId/cidr of the records found
+	}{
+		{"10.0.1.1", "", "S/B/10.0.1.0/24 S/C/10.0.1.0/24 T/D/10.0.0.0/8"},
+		{"10.0.1.1", "S", "S/B/10.0.1.0/24 S/C/10.0.1.0/24"},
+		{"10.0.2.1", "", "S/A/10.0.0.0/16 T/D/10.0.0.0/8"},
+		{"10.0.0.0", "S", "S/A/10.0.0.0/16"},
+		{"10.0.255.255", "S", "S/A/10.0.0.0/16"},
+		{"10.1.0.1", "", "S/E/0.0.0.0/0 T/D/10.0.0.0/8"},
+		{"11.0.0.1", "T", ""},
+		{"11.0.0.1", "X", ""},
+		{"::ffff:10.0.1.1", "S", "S/B/10.0.1.0/24 S/C/10.0.1.0/24"},
+		{"2001:db8:1::1", "", "S/G/2001:db8:1::/48"},
+		{"2001:db8:2::1", "S", "S/F/2001:db8::/32"},
+		// an IPv6 address is not in an IPv4 block of the same leading bits
+		{"::1", "", ""},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, rec := range idx.Lookup(net.ParseIP(tt.ip), tt.serviceCode) {
+			got = append(got, rec.ServiceCode+"/"+rec.GLBID+"/"+rec.CIDR)
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("Lookup(%s, %s) %v, want %s", tt.ip, tt.serviceCode, got, tt.want)
+		}
+	}
+
+	if got := idx.Lookup(nil, ""); got != nil {
+		t.Errorf("Lookup(nil) %v, want nil", got)
+	}
+}
@@ -0,0 +1,113 @@
+package ipms
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/castisdev/cilog"
+)
+
+// reject reasons
+const (
+	RejectInvalidRow        = "invalid-row"
+	RejectInvalidIP         = "invalid-ip"
+	RejectUnknownOfficeCode = "unknown-office-code"
+	RejectDuplicate         = "duplicate"
+	RejectFiltered          = "filtered"
+	RejectMultiGLBRejected  = "multi-glb-rejected"
+)
+
+// reject file formats
+const (
+	RejectFormatCSV   = "csv"
+	RejectFormatJSONL = "jsonl"
+)
+
+// Reject : an input line that was dropped
+// Detail is the reason in words, like the field count, the filter name or the netMask of a duplicate
+type Reject struct {
+	File       string `json:"file"`
+	Line       int    `json:"line"`
+	Reason     string `json:"reason"`
+	Detail     string `json:"detail"`
+	OfficeCode string `json:"officeCode"`
+	Raw        string `json:"raw"`
+}
+
+func (stats *SourceStats) reject(row *RangeRow, reason, detail string) {
+	stats.Rejects = append(stats.Rejects, &Reject{
+		Line:       row.Line,
+		Reason:     reason,
+		Detail:     detail,
+		OfficeCode: strings.TrimSpace(row.OfficeCode),
+		Raw:        row.Raw,
+	})
+}
+
+// Rejects : rejects of every file in order
+func (s *InputStats) Rejects() []*Reject {
+	var l []*Reject
+	for _, st := range s.Stats {
+		l = append(l, st.Rejects...)
+	}
+	return l
+}
+
+func rejectFormat(cfg *YmlConfig) string {
+	if cfg.RejectFormat != "" {
+		return cfg.RejectFormat
+	}
+	switch strings.ToLower(filepath.Ext(cfg.RejectFile)) {
+	case ".jsonl", ".json":
+		return RejectFormatJSONL
+	}
+	return RejectFormatCSV
+}
+
+// WriteRejectFile : writes the rejects of stats to reject-file of cfg, nothing when reject-file does not exist
+func WriteRejectFile(cfg *YmlConfig, stats *InputStats) error {
+	if cfg == nil || cfg.RejectFile == "" || stats == nil {
+		return nil
+	}
+	rejects := stats.Rejects()
+	w, err := CreateOutput(cfg.RejectFile)
+	if err != nil {
+		return err
+	}
+
+	switch rejectFormat(cfg) {
+	case RejectFormatJSONL:
+		enc := json.NewEncoder(w)
+		for _, r := range rejects {
+			if err = enc.Encode(r); err != nil {
+				break
+			}
+		}
+	default:
+		cw := csv.NewWriter(w)
+		err = cw.Write([]string{"file", "line", "reason", "detail", "officeCode", "raw"})
+		for _, r := range rejects {
+			if err != nil {
+				break
+			}
+			err = cw.Write([]string{r.File, strconv.Itoa(r.Line), r.Reason, r.Detail, r.OfficeCode, r.Raw})
+		}
+		cw.Flush()
+		if err == nil {
+			err = cw.Error()
+		}
+	}
+	if err != nil {
+		w.Close()
+		return fmt.Errorf("failed to write %s, %v", cfg.RejectFile, err)
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	cilog.Infof("success to write rejects[%d] to %s", len(rejects), cfg.RejectFile)
+	return nil
+}
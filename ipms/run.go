@@ -0,0 +1,223 @@
+package ipms
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/castisdev/cilog"
+)
+
+// ImportOptions : command line options of an import
+type ImportOptions struct {
+	Format       string
+	DryRun       bool
+	DryRunOutput string
+	Pretty       bool
+	Force        bool
+}
+
+// ImportRun : an import from the mapping to the post
+// Records are the records of Inputs, and the records to import after ResolveRecords
+// InputRecords is the number of records read from Inputs, ResolveRecords does not change it
+type ImportRun struct {
+	Inputs        []string
+	Tables        *MappingTables
+	Mapping       map[string][]OfficeGLBIDMapping
+	MappingStatus *MappingStatus
+	Records       []*IpmsRecord
+	InputRecords  int
+	InputStats    *InputStats
+	Overrides     []*OverrideResult
+}
+
+// InputError : an import error caused by the inputs themselves, such as a bad file or a blocking validation
+// importing the same inputs again fails the same way, other errors, such as an API outage, may not
+type InputError struct {
+	Err error
+}
+
+func (e *InputError) Error() string {
+	return e.Err.Error()
+}
+
+// IsInputError : whether err is an InputError
+func IsInputError(err error) bool {
+	var ie *InputError
+	return errors.As(err, &ie)
+}
+
+func inputErrorf(format string, a ...interface{}) error {
+	return &InputError{Err: fmt.Errorf(format, a...)}
+}
+
+func warnf(format string, a ...interface{}) {
+	str := fmt.Sprintf(format, a...)
+	cilog.Warningf(str)
+	fmt.Fprintln(os.Stderr, str)
+}
+
+// LoadImport : gets the mapping of cfg, reads the records of inputs by format and writes their rejects
+// an error of reading the inputs is an InputError
+func LoadImport(cfg *YmlConfig, format string, inputs []string) (*ImportRun, error) {
+	tables, mapping, status, err := GetResolvedMapping(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mapping info, %v", err)
+	}
+	for _, m := range status.Stale {
+		warnf("WARNING, using stale %v", m)
+	}
+
+	recs, stats, err := LoadIPMSRecordsFiles(format, inputs, cfg, mapping, status.MultiGLB)
+	if err != nil {
+		return nil, inputErrorf("failed to get ipms records, %v", err)
+	}
+	if err := WriteRejectFile(cfg, stats); err != nil {
+		return nil, fmt.Errorf("failed to write reject file, %v", err)
+	}
+	return &ImportRun{
+		Inputs:        inputs,
+		Tables:        tables,
+		Mapping:       mapping,
+		MappingStatus: status,
+		Records:       recs,
+		InputRecords:  len(recs),
+		InputStats:    stats,
+	}, nil
+}
+
+// ResolveRecords : applies override-file and conflict-policy of cfg to the records
+// a conflict of conflict-policy fail is an InputError
+func (r *ImportRun) ResolveRecords(cfg *YmlConfig) error {
+	recs, overrides, err := LoadAndApplyOverrides(cfg, r.Records)
+	if err != nil {
+		return fmt.Errorf("failed to apply overrides, %v", err)
+	}
+	recs, err = ResolveConflicts(recs, cfg.ConflictPolicy)
+	if err != nil {
+		return inputErrorf("failed to resolve conflicts, %v", err)
+	}
+	r.Records, r.Overrides = recs, overrides
+	return nil
+}
+
+// LoadResolvedRecords : the records of inputs read by format with the mapping of r, override-file and conflict-policy of cfg applied
+// no reject file is written
+func (r *ImportRun) LoadResolvedRecords(cfg *YmlConfig, format string, inputs []string) ([]*IpmsRecord, error) {
+	recs, _, err := LoadIPMSRecordsFiles(format, inputs, cfg, r.Mapping, r.MappingStatus.MultiGLB)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ipms records, %v", err)
+	}
+	prev := &ImportRun{Records: recs}
+	if err := prev.ResolveRecords(cfg); err != nil {
+		return nil, err
+	}
+	return prev.Records, nil
+}
+
+// mergeAndCheck : merges the records of r and checks the coverage and the safety of the result
+func (r *ImportRun) mergeAndCheck(cfg *YmlConfig) ([]*ServiceCodeInfo, *RunSummary, []*SafetyViolation, error) {
+	resultSet, err := MergeIPMSRecords(r.Records)
+	if err != nil {
+		return nil, nil, nil, inputErrorf("failed to merge ipms records, %v", err)
+	}
+
+	diffs, err := VerifyCoverage(r.Records, resultSet)
+	if err != nil {
+		return nil, nil, nil, inputErrorf("failed to verify merged records, %v", err)
+	}
+	if len(diffs) > 0 {
+		for _, d := range diffs {
+			str := fmt.Sprintf("coverage changed by merge, %v", d)
+			cilog.Errorf(str)
+			fmt.Fprintln(os.Stderr, str)
+		}
+		return nil, nil, nil, inputErrorf("failed to verify merged records, coverage changed[%d]", len(diffs))
+	}
+
+	// the records read, conflict-policy and override-file may split or add records
+	summary := &RunSummary{InputRecords: r.InputRecords, OverrideRecords: OverrideAdded(r.Overrides), Mapping: r.MappingStatus, Inputs: r.InputStats, Overrides: r.Overrides, Infos: resultSet}
+	violations, err := CheckSafety(cfg, r.InputStats, r.InputRecords, resultSet)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to check safety, %v", err)
+	}
+	for _, v := range violations {
+		summary.Notef("safety violation, %v", v)
+	}
+	return resultSet, summary, violations, nil
+}
+
+// RunImport : merges the records of r, checks the safety, and then posts them and saves the history,
+// or writes them by DryRun of opt
+// an error of the merge, the coverage or a blocking safety violation is an InputError
+func RunImport(cfg *YmlConfig, opt *ImportOptions, r *ImportRun) error {
+	resultSet, summary, violations, err := r.mergeAndCheck(cfg)
+	if err != nil {
+		return err
+	}
+	summary.Log()
+
+	if opt.DryRun {
+		if err := WriteDryRun(cfg, resultSet, summary, opt.DryRunOutput, opt.Pretty); err != nil {
+			return fmt.Errorf("failed to dry-run, %v", err)
+		}
+		return nil
+	}
+
+	if len(violations) > 0 {
+		if !opt.Force {
+			for _, v := range violations {
+				str := fmt.Sprintf("safety violation, %v", v)
+				cilog.Errorf(str)
+				fmt.Fprintln(os.Stderr, str)
+			}
+			return inputErrorf("blocked by safety check, violations[%d], use -force to import anyway", len(violations))
+		}
+		cilog.Warningf("ignore safety violations[%d] by -force", len(violations))
+	}
+
+	if err := ImportIPMSRecords(cfg, resultSet); err != nil {
+		return fmt.Errorf("failed to post ipms records, %v", err)
+	}
+	// the import is done, a history that could not be saved does not fail it
+	if err := SaveIPMSHistory(cfg, r.Inputs, r.Mapping, resultSet); err != nil {
+		warnf("WARNING, posted, but failed to save history, %v", err)
+	}
+
+	str := fmt.Sprintf("success to import, %s", strings.Join(r.Inputs, ", "))
+	cilog.Infof(str)
+	fmt.Println(str)
+	return nil
+}
+
+// PrintIPMSHistory : prints the entries of history-directory of cfg
+func PrintIPMSHistory(w io.Writer, cfg *YmlConfig) error {
+	if cfg.HistoryDirectory == "" {
+		return errors.New("failed to list history, history-directory not exist")
+	}
+	entries, err := ListHistory(cfg.HistoryDirectory)
+	if err != nil {
+		return fmt.Errorf("failed to list history, %v", err)
+	}
+	PrintHistory(w, entries)
+	return nil
+}
+
+// RunRollback : RollbackIPMS, and then saves the new history entry
+func RunRollback(cfg *YmlConfig, id string) error {
+	e, err := RollbackIPMS(cfg, id)
+	if err != nil {
+		return fmt.Errorf("failed to rollback to history[%s], %v", id, err)
+	}
+	// the rollback is done, a history that could not be saved does not fail it
+	if err := SaveHistory(cfg.HistoryDirectory, e, cfg.HistoryKeep); err != nil {
+		warnf("WARNING, posted, but failed to save history, %v", err)
+		e.ID = ""
+	}
+	str := fmt.Sprintf("success to rollback to history[%s], netMasks[%d], new history[%s]", id, e.NetMasks(), e.ID)
+	cilog.Infof(str)
+	fmt.Println(str)
+	return nil
+}
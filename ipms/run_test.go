@@ -0,0 +1,136 @@
+package ipms
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestFiles : files of name and content in a temporary directory, returns the directory
+func writeTestFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// testImportConfig : mapping files of dir, R00001 to glbId A and R00002 to glbId B of serviceCode S
+func testImportConfig(t *testing.T, dir string) *YmlConfig {
+	for name, content := range map[string]string{
+		"office.csv": "nodeCode,officeCode\nN1,R00001\nN2,R00002\n",
+		"glb.csv":    "nodeCode,serviceCode,glbId\nN1,S,A\nN2,S,B\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &YmlConfig{
+		OfficeNodeFile: filepath.Join(dir, "office.csv"),
+		NodeGLBIDFile:  filepath.Join(dir, "glb.csv"),
+		ConflictPolicy: ConflictPolicyMostSpecific,
+		ImportMode:     ImportModeFull,
+		InputEncoding:  EncodingAuto,
+	}
+}
+
+func TestRunImportMinRecords(t *testing.T) {
+	// the /24 of glbId B splits the /16 of glbId A into 8 records by most-specific
+	dir := writeTestFiles(t, map[string]string{
+		"in.csv": "10.0.0.0|10.0.255.255|a|R00001|a|x|00|x\n" +
+			"10.0.128.0|10.0.128.255|a|R00002|a|x|00|x\n",
+	})
+	cfg := testImportConfig(t, dir)
+	cfg.Safety = &SafetyConfig{MinRecords: 5}
+
+	r, err := LoadImport(cfg, "ipms-v2", []string{filepath.Join(dir, "in.csv")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.ResolveRecords(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Records) < cfg.Safety.MinRecords {
+		t.Fatalf("records[%d] after conflict-policy, want at least min-records[%d]", len(r.Records), cfg.Safety.MinRecords)
+	}
+
+	_, _, violations, err := r.mergeAndCheck(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(violations) != 1 || violations[0].Check != "min-records" || violations[0].Value != 2 {
+		t.Errorf("violations %v, want min-records of records[2]", violations)
+	}
+}
+
+func TestRunImportSummaryRecords(t *testing.T) {
+	// the first rule splits a record of the input into 3, the second adds a record
+	dir := writeTestFiles(t, map[string]string{
+		"in.csv": "10.0.0.0|10.0.0.255|a|R00001|a|x|00|x\n" +
+			"10.0.1.0|10.0.1.255|a|R00001|a|x|00|x\n",
+		"ov.csv": "cidr,serviceCode,glbId,netCode,action\n" +
+			"10.0.0.64/26,S,B,,assign\n" +
+			"10.0.2.0/24,S,B,01,assign\n",
+	})
+	cfg := testImportConfig(t, dir)
+	cfg.OverrideFile = filepath.Join(dir, "ov.csv")
+	cfg.Safety = &SafetyConfig{MinRecords: 3}
+
+	r, err := LoadImport(cfg, "ipms-v2", []string{filepath.Join(dir, "in.csv")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.ResolveRecords(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Records) != 5 {
+		t.Fatalf("records[%d] after override-file, want 5", len(r.Records))
+	}
+
+	_, summary, violations, err := r.mergeAndCheck(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.InputRecords != 2 || summary.OverrideRecords != 1 {
+		t.Errorf("summary input records[%d], override records[%d], want 2 and 1", summary.InputRecords, summary.OverrideRecords)
+	}
+	if len(violations) != 1 || violations[0].Check != "min-records" || violations[0].Value != 2 {
+		t.Errorf("violations %v, want min-records of records[2]", violations)
+	}
+}
+
+func TestRunImportInputError(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"in.csv": "10.0.0.0|10.0.0.255|a|R00001|a|x|00|x\n",
+	})
+	cfg := testImportConfig(t, dir)
+
+	_, err := LoadImport(cfg, "ipms-v2", []string{filepath.Join(dir, "none.csv")})
+	if err == nil || !IsInputError(err) {
+		t.Errorf("missing input, err %v, want an input error", err)
+	}
+
+	// the mapping is not of the inputs, importing them again may succeed
+	noMapping := *cfg
+	noMapping.OfficeNodeFile = filepath.Join(dir, "none.csv")
+	_, err = LoadImport(&noMapping, "ipms-v2", []string{filepath.Join(dir, "in.csv")})
+	if err == nil || IsInputError(err) {
+		t.Errorf("missing mapping, err %v, want an error other than an input error", err)
+	}
+
+	cfg.Safety = &SafetyConfig{MinRecords: 5}
+	r, err := LoadImport(cfg, "ipms-v2", []string{filepath.Join(dir, "in.csv")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.ResolveRecords(cfg); err != nil {
+		t.Fatal(err)
+	}
+	err = RunImport(cfg, &ImportOptions{Format: "ipms-v2"}, r)
+	if err == nil || !IsInputError(err) || !strings.Contains(err.Error(), "blocked by safety check") {
+		t.Errorf("safety violation, err %v, want a blocking input error", err)
+	}
+}
@@ -0,0 +1,240 @@
+package ipms
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/castisdev/cilog"
+)
+
+// SafetyConfig : thresholds checked before import, a nil threshold is not checked
+// percents are 0 to 100, the per glbId thresholds compare with last-import-file
+type SafetyConfig struct {
+	MaxInvalidPercent       *float64 `yaml:"max-invalid-percent"`
+	MaxUnknownOfficePercent *float64 `yaml:"max-unknown-office-percent"`
+	MinRecords              int      `yaml:"min-records"`
+	MaxCIDRDropPercent      *float64 `yaml:"max-glb-netmask-drop-percent"`
+	MaxCIDRChangePercent    *float64 `yaml:"max-glb-netmask-change-percent"`
+	MaxAddressDropPercent   *float64 `yaml:"max-glb-address-drop-percent"`
+	MaxAddressChangePercent *float64 `yaml:"max-glb-address-change-percent"`
+}
+
+func (c *SafetyConfig) validate(lastImportFile string) error {
+	percents := map[string]*float64{
+		"max-invalid-percent":            c.MaxInvalidPercent,
+		"max-unknown-office-percent":     c.MaxUnknownOfficePercent,
+		"max-glb-netmask-drop-percent":   c.MaxCIDRDropPercent,
+		"max-glb-netmask-change-percent": c.MaxCIDRChangePercent,
+		"max-glb-address-drop-percent":   c.MaxAddressDropPercent,
+		"max-glb-address-change-percent": c.MaxAddressChangePercent,
+	}
+	for name, p := range percents {
+		if p != nil && (*p < 0 || *p > 100) {
+			return fmt.Errorf("invalid %s[%v], must be 0 to 100", name, *p)
+		}
+	}
+	if c.MinRecords < 0 {
+		return fmt.Errorf("invalid min-records[%d]", c.MinRecords)
+	}
+	if c.glbChecks() && lastImportFile == "" {
+		return errors.New("max-glb-* needs last-import-file")
+	}
+	return nil
+}
+
+func (c *SafetyConfig) glbChecks() bool {
+	return c.MaxCIDRDropPercent != nil || c.MaxCIDRChangePercent != nil ||
+		c.MaxAddressDropPercent != nil || c.MaxAddressChangePercent != nil
+}
+
+// SafetyViolation : a threshold that an import exceeds
+// Scope is empty for the whole input, or serviceCode/glbId
+type SafetyViolation struct {
+	Check  string
+	Scope  string
+	Value  float64
+	Limit  float64
+	Detail string
+}
+
+func (v *SafetyViolation) String() string {
+	scope := ""
+	if v.Scope != "" {
+		scope = fmt.Sprintf("%s, ", v.Scope)
+	}
+	return fmt.Sprintf("%s, %s%v exceeds limit %v, %s", v.Check, scope, round2(v.Value), v.Limit, v.Detail)
+}
+
+func round2(f float64) float64 {
+	return float64(int64(f*100+0.5)) / 100
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(total)
+}
+
+func bigPercent(n, total *big.Int) float64 {
+	if total.Sign() == 0 {
+		return 0
+	}
+	f, _ := new(big.Rat).SetFrac(new(big.Int).Mul(n, big.NewInt(100)), total).Float64()
+	return f
+}
+
+// addressCount : number of addresses of merged ranges
+func addressCount(rs []IPRange) *big.Int {
+	n := new(big.Int)
+	for _, r := range rs {
+		d := new(big.Int).Sub(new(big.Int).SetBytes(r.End), new(big.Int).SetBytes(r.Start))
+		n.Add(n, d.Add(d, big.NewInt(1)))
+	}
+	return n
+}
+
+// CheckSafety : violations of safety of cfg by an import of infos read with stats
+// records is the number of records read from the inputs, before override-file, conflict-policy and merge
+func CheckSafety(cfg *YmlConfig, stats *InputStats, records int, infos []*ServiceCodeInfo) ([]*SafetyViolation, error) {
+	c := cfg.Safety
+	if c == nil {
+		return nil, nil
+	}
+	var violations []*SafetyViolation
+
+	if stats != nil {
+		lines, invalid, unknown := 0, 0, 0
+		for _, st := range stats.Stats {
+			// filtered lines are dropped on purpose
+			lines += st.Lines - st.FilteredLines
+			// multi-glb-rejected lines are known offices rejected by the policy, not unknown offices
+			for _, r := range st.Rejects {
+				switch r.Reason {
+				case RejectInvalidRow, RejectInvalidIP:
+					invalid++
+				case RejectUnknownOfficeCode:
+					unknown++
+				}
+			}
+		}
+		if p := c.MaxInvalidPercent; p != nil && percent(invalid, lines) > *p {
+			violations = append(violations, &SafetyViolation{
+				Check: "max-invalid-percent", Value: percent(invalid, lines), Limit: *p,
+				Detail: fmt.Sprintf("invalid lines[%d] of lines[%d], see reject-file or the log for the lines", invalid, lines),
+			})
+		}
+		if p := c.MaxUnknownOfficePercent; p != nil && percent(unknown, lines) > *p {
+			violations = append(violations, &SafetyViolation{
+				Check: "max-unknown-office-percent", Value: percent(unknown, lines), Limit: *p,
+				Detail: fmt.Sprintf("lines of unknown office code[%d] of lines[%d], the office code mapping may be outdated", unknown, lines),
+			})
+		}
+	}
+	if c.MinRecords > 0 && records < c.MinRecords {
+		violations = append(violations, &SafetyViolation{
+			Check: "min-records", Value: float64(records), Limit: float64(c.MinRecords),
+			Detail: fmt.Sprintf("records[%d] is less than min-records[%d], the input may be truncated", records, c.MinRecords),
+		})
+	}
+
+	if !c.glbChecks() {
+		return violations, nil
+	}
+	prev, err := LoadServiceCodeInfos(cfg.LastImportFile)
+	if os.IsNotExist(err) {
+		cilog.Warningf("last import not exist, %s, skip max-glb-* checks", cfg.LastImportFile)
+		return violations, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	glbViolations, err := checkGLBChanges(c, prev, infos)
+	if err != nil {
+		return nil, err
+	}
+	return append(violations, glbViolations...), nil
+}
+
+// checkGLBChanges : a glbId that is not in prev is not checked, a glbId that is not in cur dropped 100%
+func checkGLBChanges(c *SafetyConfig, prev, cur []*ServiceCodeInfo) ([]*SafetyViolation, error) {
+	prevSet := netMaskSet(prev)
+	curSet := netMaskSet(cur)
+	prevRanges, err := infoRanges(prev)
+	if err != nil {
+		return nil, err
+	}
+	curRanges, err := infoRanges(cur)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []glbKey
+	for k := range prevSet {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].serviceCode != keys[j].serviceCode {
+			return keys[i].serviceCode < keys[j].serviceCode
+		}
+		return keys[i].glbID < keys[j].glbID
+	})
+
+	var violations []*SafetyViolation
+	for _, k := range keys {
+		scope := fmt.Sprintf("serviceCode[%s], glbId[%s]", k.serviceCode, k.glbID)
+		p, q := prevSet[k], curSet[k]
+		removed := len(missingNetMasks(p, q))
+		added := len(missingNetMasks(q, p))
+
+		if l := c.MaxCIDRDropPercent; l != nil && len(q) < len(p) {
+			v := percent(len(p)-len(q), len(p))
+			if v > *l {
+				violations = append(violations, &SafetyViolation{
+					Check: "max-glb-netmask-drop-percent", Scope: scope, Value: v, Limit: *l,
+					Detail: fmt.Sprintf("netMasks[%d] to [%d]", len(p), len(q)),
+				})
+			}
+		}
+		if l := c.MaxCIDRChangePercent; l != nil {
+			v := percent(added+removed, len(p))
+			if v > *l {
+				violations = append(violations, &SafetyViolation{
+					Check: "max-glb-netmask-change-percent", Scope: scope, Value: v, Limit: *l,
+					Detail: fmt.Sprintf("netMasks[%d], added[%d], removed[%d]", len(p), added, removed),
+				})
+			}
+		}
+
+		if c.MaxAddressDropPercent == nil && c.MaxAddressChangePercent == nil {
+			continue
+		}
+		pr := mergeRanges(prevRanges[coverageKey{k.serviceCode, k.glbID}])
+		cr := mergeRanges(curRanges[coverageKey{k.serviceCode, k.glbID}])
+		total := addressCount(pr)
+		lost := addressCount(subtractRanges(pr, cr))
+		gained := addressCount(subtractRanges(cr, pr))
+		if l := c.MaxAddressDropPercent; l != nil {
+			v := bigPercent(lost, total)
+			if v > *l {
+				violations = append(violations, &SafetyViolation{
+					Check: "max-glb-address-drop-percent", Scope: scope, Value: v, Limit: *l,
+					Detail: fmt.Sprintf("addresses[%v], lost[%v]", total, lost),
+				})
+			}
+		}
+		if l := c.MaxAddressChangePercent; l != nil {
+			v := bigPercent(new(big.Int).Add(lost, gained), total)
+			if v > *l {
+				violations = append(violations, &SafetyViolation{
+					Check: "max-glb-address-change-percent", Scope: scope, Value: v, Limit: *l,
+					Detail: fmt.Sprintf("addresses[%v], lost[%v], added[%v]", total, lost, gained),
+				})
+			}
+		}
+	}
+	return violations, nil
+}
@@ -0,0 +1,227 @@
+package ipms
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func percentOf(f float64) *float64 {
+	return &f
+}
+
+// testRejects : n rejects of each reason
+func testRejects(reasons map[string]int) []*Reject {
+	var l []*Reject
+	for reason, n := range reasons {
+		for i := 0; i < n; i++ {
+			l = append(l, &Reject{Reason: reason})
+		}
+	}
+	return l
+}
+
+func violationStrings(violations []*SafetyViolation) string {
+	var l []string
+	for _, v := range violations {
+		s := v.Check
+		if v.Scope != "" {
+			s += " " + v.Scope
+		}
+		l = append(l, fmt.Sprintf("%s %v", s, round2(v.Value)))
+	}
+	return strings.Join(l, "\n")
+}
+
+func TestSafetyConfigValidate(t *testing.T) {
+	tests := []struct {
+		name           string
+		cfg            SafetyConfig
+		lastImportFile string
+		wantErr        string // empty when the config is valid
+	}{
+		{name: "none"},
+		{name: "0 and 100", cfg: SafetyConfig{MaxInvalidPercent: percentOf(0), MaxUnknownOfficePercent: percentOf(100)}},
+		{name: "negative percent", cfg: SafetyConfig{MaxInvalidPercent: percentOf(-1)}, wantErr: "invalid max-invalid-percent[-1], must be 0 to 100"},
+		{name: "percent over 100", cfg: SafetyConfig{MaxUnknownOfficePercent: percentOf(100.5)}, wantErr: "invalid max-unknown-office-percent[100.5]"},
+		{name: "glb percent over 100", cfg: SafetyConfig{MaxAddressChangePercent: percentOf(101)}, lastImportFile: "last.json", wantErr: "invalid max-glb-address-change-percent[101]"},
+		{name: "negative min-records", cfg: SafetyConfig{MinRecords: -1}, wantErr: "invalid min-records[-1]"},
+		{name: "max-glb-* without last-import-file", cfg: SafetyConfig{MaxCIDRDropPercent: percentOf(30)}, wantErr: "max-glb-* needs last-import-file"},
+		{name: "max-glb-* with last-import-file", cfg: SafetyConfig{MaxCIDRChangePercent: percentOf(30)}, lastImportFile: "last.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.validate(tt.lastImportFile)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Error(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckSafetyInput(t *testing.T) {
+	// 100 lines, 20 filtered, 8 invalid, 4 unknown office, 10 multi-glb rejected of 80 lines
+	stats := &InputStats{Stats: []*SourceStats{
+		{Lines: 60, FilteredLines: 20, Rejects: testRejects(map[string]int{RejectInvalidRow: 2, RejectInvalidIP: 2, RejectUnknownOfficeCode: 4, RejectFiltered: 20})},
+		{Lines: 40, Rejects: testRejects(map[string]int{RejectInvalidRow: 4, RejectMultiGLBRejected: 10, RejectDuplicate: 3})},
+	}}
+	tests := []struct {
+		name    string
+		safety  *SafetyConfig
+		records int
+		want    string
+	}{
+		{name: "no safety", records: 0},
+		{name: "invalid under limit", safety: &SafetyConfig{MaxInvalidPercent: percentOf(10)}},
+		{name: "invalid over limit", safety: &SafetyConfig{MaxInvalidPercent: percentOf(9.99)}, want: "max-invalid-percent 10"},
+		{name: "unknown office under limit", safety: &SafetyConfig{MaxUnknownOfficePercent: percentOf(5)}},
+		{name: "unknown office over limit", safety: &SafetyConfig{MaxUnknownOfficePercent: percentOf(4)}, want: "max-unknown-office-percent 5"},
+		{name: "min-records", safety: &SafetyConfig{MinRecords: 50}, records: 49, want: "min-records 49"},
+		{name: "min-records met", safety: &SafetyConfig{MinRecords: 50}, records: 50},
+		{
+			name:    "every input check",
+			safety:  &SafetyConfig{MaxInvalidPercent: percentOf(0), MaxUnknownOfficePercent: percentOf(0), MinRecords: 1},
+			records: 0,
+			want:    "max-invalid-percent 10\nmax-unknown-office-percent 5\nmin-records 0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations, err := CheckSafety(&YmlConfig{Safety: tt.safety}, stats, tt.records, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := violationStrings(violations); got != tt.want {
+				t.Errorf("violations\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+
+	// no lines is not a violation of percents
+	violations, err := CheckSafety(&YmlConfig{Safety: &SafetyConfig{MaxInvalidPercent: percentOf(0)}}, &InputStats{Stats: []*SourceStats{{}}}, 0, nil)
+	if err != nil || len(violations) != 0 {
+		t.Errorf("violations %v, err %v, want none", violations, err)
+	}
+}
+
+func TestCheckGLBChanges(t *testing.T) {
+	prev := testInfos([]string{
+		"S A 00 10.0.0.0/24", "S A 00 10.0.1.0/24", "S A 00 10.0.2.0/24", "S A 00 10.0.3.0/24",
+		"S B 00 10.1.0.0/24",
+		"S C 00 10.2.0.0/24",
+		"S E 00 2001:db8::/32",
+		"T A 00 10.3.0.0/24",
+	})
+	cur := testInfos([]string{
+		// netMasks 4 to 3, added 1, removed 2, addresses 1024, lost 512, added 512
+		"S A 00 10.0.0.0/24", "S A 00 10.0.1.0/24", "S A 00 10.0.8.0/23",
+		// split, the same addresses
+		"S B 00 10.1.0.0/25", "S B 00 10.1.0.128/25",
+		// S/C is gone, S/D is new
+		"S D 00 10.4.0.0/16",
+		// half of the addresses
+		"S E 00 2001:db8::/33",
+		"T A 00 10.3.0.0/24",
+	})
+	tests := []struct {
+		name   string
+		safety SafetyConfig
+		want   string
+	}{
+		{
+			name:   "netmask drop",
+			safety: SafetyConfig{MaxCIDRDropPercent: percentOf(20)},
+			want:   "max-glb-netmask-drop-percent serviceCode[S], glbId[A] 25\nmax-glb-netmask-drop-percent serviceCode[S], glbId[C] 100",
+		},
+		{
+			name:   "netmask change",
+			safety: SafetyConfig{MaxCIDRChangePercent: percentOf(60)},
+			want: "max-glb-netmask-change-percent serviceCode[S], glbId[A] 75\n" +
+				"max-glb-netmask-change-percent serviceCode[S], glbId[B] 300\n" +
+				"max-glb-netmask-change-percent serviceCode[S], glbId[C] 100\n" +
+				"max-glb-netmask-change-percent serviceCode[S], glbId[E] 200",
+		},
+		{
+			name:   "netmask change at limit",
+			safety: SafetyConfig{MaxCIDRChangePercent: percentOf(100)},
+			want: "max-glb-netmask-change-percent serviceCode[S], glbId[B] 300\n" +
+				"max-glb-netmask-change-percent serviceCode[S], glbId[E] 200",
+		},
+		{
+			name:   "address drop",
+			safety: SafetyConfig{MaxAddressDropPercent: percentOf(40)},
+			want: "max-glb-address-drop-percent serviceCode[S], glbId[A] 50\n" +
+				"max-glb-address-drop-percent serviceCode[S], glbId[C] 100\n" +
+				"max-glb-address-drop-percent serviceCode[S], glbId[E] 50",
+		},
+		{
+			name:   "address change",
+			safety: SafetyConfig{MaxAddressChangePercent: percentOf(60)},
+			want:   "max-glb-address-change-percent serviceCode[S], glbId[A] 100\nmax-glb-address-change-percent serviceCode[S], glbId[C] 100",
+		},
+		{
+			name:   "no violation",
+			safety: SafetyConfig{MaxCIDRDropPercent: percentOf(100), MaxAddressDropPercent: percentOf(100), MaxAddressChangePercent: percentOf(100)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations, err := checkGLBChanges(&tt.safety, prev, cur)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := violationStrings(violations); got != tt.want {
+				t.Errorf("violations\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+
+	broken := testInfos([]string{"S A 00 10.0.0.0"})
+	if _, err := checkGLBChanges(&SafetyConfig{MaxAddressDropPercent: percentOf(10)}, broken, cur); err == nil {
+		t.Errorf("invalid netMask, want an error")
+	}
+}
+
+func TestCheckSafetyLastImport(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &YmlConfig{
+		LastImportFile: filepath.Join(dir, "last.json"),
+		Safety:         &SafetyConfig{MinRecords: 2, MaxCIDRDropPercent: percentOf(0)},
+	}
+	cur := testInfos([]string{"S A 00 10.0.0.0/24"})
+
+	// the first import has no last import to compare with
+	violations, err := CheckSafety(cfg, nil, 1, cur)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := violationStrings(violations); got != "min-records 1" {
+		t.Errorf("violations %s, want min-records only", got)
+	}
+
+	if err := SaveServiceCodeInfos(cfg.LastImportFile, testInfos([]string{"S A 00 10.0.0.0/24", "S A 00 10.0.1.0/24"})); err != nil {
+		t.Fatal(err)
+	}
+	violations, err = CheckSafety(cfg, nil, 2, cur)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := violationStrings(violations); got != "max-glb-netmask-drop-percent serviceCode[S], glbId[A] 50" {
+		t.Errorf("violations %s, want netmask drop of S/A", got)
+	}
+
+	if err := ioutil.WriteFile(cfg.LastImportFile, []byte("["), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CheckSafety(cfg, nil, 2, cur); err == nil {
+		t.Errorf("broken last import, want an error")
+	}
+}
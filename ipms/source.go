@@ -0,0 +1,347 @@
+package ipms
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/castisdev/cilog"
+)
+
+// descriptive fields of a RangeRow
+const (
+	FieldBeallorg   = "beallorg"
+	FieldOfficeName = "office-name"
+	FieldPubpri     = "pubpri"
+	FieldAssrole    = "assrole"
+)
+
+// RangeRow : an address range read from a Source
+// EndIP is empty when the range is given by StartIP and Prefix
+// Invalid is the reason when the row could not be split into fields
+type RangeRow struct {
+	Line       int
+	Raw        string
+	StartIP    string
+	EndIP      string
+	Prefix     string
+	OfficeCode string
+	NetCode    string
+	Fields     map[string]string
+	Invalid    string
+}
+
+// Source : streams the range rows of an input, Next returns io.EOF at the end
+type Source interface {
+	Next() (*RangeRow, error)
+	Close() error
+}
+
+// SourceOpener :
+type SourceOpener func(filename string, cfg *YmlConfig) (Source, error)
+
+// SourceFields : the filter fields that the rows of a format have, see RegisterSourceFields
+type SourceFields func(cfg *YmlConfig) []string
+
+var (
+	sourcesMu    sync.Mutex
+	sources      = map[string]SourceOpener{}
+	sourceFields = map[string]SourceFields{}
+)
+
+// RegisterSource : makes an input format available by name, like database/sql drivers
+func RegisterSource(format string, opener SourceOpener) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	if opener == nil {
+		panic("ipms: RegisterSource opener is nil")
+	}
+	if _, dup := sources[format]; dup {
+		panic("ipms: RegisterSource called twice for format " + format)
+	}
+	sources[format] = opener
+}
+
+// RegisterSourceFields : the filter fields of format, filters of the other fields are rejected
+// a format without them has office-code and net-code
+func RegisterSourceFields(format string, fields SourceFields) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	if fields == nil {
+		panic("ipms: RegisterSourceFields fields is nil")
+	}
+	sourceFields[format] = fields
+}
+
+// formatFields : filter fields of format, and whether format is registered
+func formatFields(format string, cfg *YmlConfig) ([]string, bool) {
+	sourcesMu.Lock()
+	_, ok := sources[format]
+	fields := sourceFields[format]
+	sourcesMu.Unlock()
+	if fields == nil {
+		return []string{FilterFieldOfficeCode, FilterFieldNetCode}, ok
+	}
+	return fields(cfg), ok
+}
+
+// SourceFormats : registered input formats
+func SourceFormats() []string {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	var l []string
+	for format := range sources {
+		l = append(l, format)
+	}
+	sort.Strings(l)
+	return l
+}
+
+// OpenSource :
+func OpenSource(format, filename string, cfg *YmlConfig) (Source, error) {
+	sourcesMu.Lock()
+	opener, ok := sources[format]
+	sourcesMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown input format, %s, registered formats%v", format, SourceFormats())
+	}
+	return opener(filename, cfg)
+}
+
+// SourceStats : statistics of reading a Source
+// FailedOfficeCodes has the last line of each unknown office code
+// MultiGLBRejectedLines is the number of lines that have a serviceCode rejected by multi-glb
+// Filtered has the number of lines dropped by each filter rule
+// Rejects has every dropped line
+type SourceStats struct {
+	Lines                 int
+	InvalidLines          int
+	FilteredLines         int
+	Records               int
+	MultiGLBRejectedLines int
+	FailedOfficeCodes     map[string]int
+	Filtered              map[string]int
+	Rejects               []*Reject
+}
+
+// newSourceStats : Filtered has every rule, so that a rule which dropped nothing is reported too
+func newSourceStats(filters []*FilterRule) *SourceStats {
+	stats := &SourceStats{FailedOfficeCodes: map[string]int{}, Filtered: map[string]int{}}
+	for _, r := range filters {
+		stats.Filtered[r.Name] = 0
+	}
+	return stats
+}
+
+func (stats *SourceStats) log(filename string) {
+	for k, v := range stats.FailedOfficeCodes {
+		cilog.Warningf("invalid office code, %s, line[%d]", k, v)
+	}
+	for k, v := range stats.Filtered {
+		cilog.Infof("filtered by filter[%s], lines[%d]", k, v)
+	}
+	cilog.Infof("success to parse %s, lines[%d], invalid lines[%d], filtered lines[%d], records[%d]", filename, stats.Lines, stats.InvalidLines, stats.FilteredLines, stats.Records)
+}
+
+// scanRows : calls fn for every row that could be split into fields and is not dropped by filters
+func scanRows(src Source, stats *SourceStats, filters []*FilterRule, fn func(row *RangeRow) error) error {
+	for {
+		row, err := src.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		stats.Lines++
+		if row.Invalid != "" {
+			cilog.Warningf("invalid line[%d], %s, %s", row.Line, row.Invalid, row.Raw)
+			stats.InvalidLines++
+			stats.reject(row, RejectInvalidRow, row.Invalid)
+			continue
+		}
+		if r := filterRow(filters, row); r != nil {
+			cilog.Debugf("filtered line[%d], filter[%s], %s", row.Line, r.Name, row.Raw)
+			stats.Filtered[r.Name]++
+			stats.FilteredLines++
+			stats.reject(row, RejectFiltered, fmt.Sprintf("filter[%s]", r.Name))
+			continue
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+}
+
+// parseRange : cidrs of the row, false when the range is invalid
+func (stats *SourceStats) parseRange(row *RangeRow) ([]*net.IPNet, bool) {
+	if row.EndIP == "" {
+		_, ipnet, err := net.ParseCIDR(row.StartIP + "/" + row.Prefix)
+		if err != nil {
+			cilog.Warningf("invalid row[%d], %s, %s", row.Line, row.StartIP, row.Prefix)
+			stats.InvalidLines++
+			stats.reject(row, RejectInvalidIP, fmt.Sprintf("start ip[%s], prefix[%s]", row.StartIP, row.Prefix))
+			return nil, false
+		}
+		return []*net.IPNet{ipnet}, true
+	}
+
+	ips := net.ParseIP(row.StartIP)
+	ipe := net.ParseIP(row.EndIP)
+	if ips == nil || ipe == nil {
+		cilog.Warningf("invalid row[%d], %s, %s", row.Line, row.StartIP, row.EndIP)
+		stats.InvalidLines++
+		stats.reject(row, RejectInvalidIP, fmt.Sprintf("start ip[%s], end ip[%s]", row.StartIP, row.EndIP))
+		return nil, false
+	}
+	cidrs := Range2CIDRs(ips, ipe)
+	if len(cidrs) == 0 {
+		cilog.Warningf("invalid range[%d], %s, %s", row.Line, row.StartIP, row.EndIP)
+		stats.InvalidLines++
+		stats.reject(row, RejectInvalidIP, fmt.Sprintf("invalid range, start ip[%s], end ip[%s]", row.StartIP, row.EndIP))
+		return nil, false
+	}
+	return cidrs, true
+}
+
+// ReadIPMSRecords : records of every glbId mapped to the office code of each row that filters keep
+// the lines of a serviceCode that decisions of multi-glb rejected are rejected as multi-glb-rejected
+func ReadIPMSRecords(src Source, mapping map[string][]OfficeGLBIDMapping, decisions []*MultiGLBDecision, filters []*FilterRule) ([]*IpmsRecord, *SourceStats, error) {
+	var recs []*IpmsRecord
+	stats := newSourceStats(filters)
+	rejected := MultiGLBRejected(decisions)
+	err := scanRows(src, stats, filters, func(row *RangeRow) error {
+		glbs, ok := mapping[row.OfficeCode]
+		serviceCodes := rejected[row.OfficeCode]
+		if !ok && len(serviceCodes) == 0 {
+			stats.FailedOfficeCodes[row.OfficeCode] = row.Line
+			stats.InvalidLines++
+			stats.reject(row, RejectUnknownOfficeCode, "")
+			return nil
+		}
+		cidrs, ok := stats.parseRange(row)
+		if !ok {
+			return nil
+		}
+		for _, glb := range glbs {
+			for _, cidr := range cidrs {
+				rec, err := NewRecordFromCIDR(glb.ServiceCode, glb.GLBID, row.NetCode, row.OfficeCode, cidr)
+				if err != nil {
+					return err
+				}
+				rec.Line = row.Line
+				rec.Raw = row.Raw
+				recs = append(recs, rec)
+			}
+		}
+		// the other serviceCodes of the line are imported
+		for _, sc := range serviceCodes {
+			stats.reject(row, RejectMultiGLBRejected, fmt.Sprintf("officeCode[%s], serviceCode[%s]", row.OfficeCode, sc))
+		}
+		if len(serviceCodes) > 0 {
+			stats.MultiGLBRejectedLines++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	stats.Records = len(recs)
+	return recs, stats, nil
+}
+
+type checkItem struct {
+	beallorg   string
+	officeName string
+	cidr       string
+}
+
+// ReadReportCollectorRecords : records of beallorg and office name of each row, duplicated records are dropped
+// ServiceCode is beallorg, GLBID and OfficeCode are office name
+func ReadReportCollectorRecords(src Source, filters []*FilterRule) ([]*IpmsRecord, *SourceStats, error) {
+	var recs []*IpmsRecord
+	stats := newSourceStats(filters)
+	checker := make(map[checkItem]struct{})
+	err := scanRows(src, stats, filters, func(row *RangeRow) error {
+		cidrs, ok := stats.parseRange(row)
+		if !ok {
+			return nil
+		}
+		beallorg := row.Fields[FieldBeallorg]
+		officeName := row.Fields[FieldOfficeName]
+		var dups []string
+		kept := 0
+		for _, cidr := range cidrs {
+			rec, err := NewRecordFromCIDR(beallorg, officeName, "", officeName, cidr)
+			if err != nil {
+				return err
+			}
+			rec.Line = row.Line
+			rec.Raw = row.Raw
+			ci := checkItem{beallorg, officeName, rec.CIDR}
+			if _, ok := checker[ci]; ok {
+				cilog.Warningf("duplicate record, line[%d], %s", row.Line, row.Raw)
+				stats.InvalidLines++
+				dups = append(dups, rec.CIDR)
+				continue
+			}
+			checker[ci] = struct{}{}
+			recs = append(recs, rec)
+			kept++
+		}
+		// a line that still has a netMask is imported, only warned
+		if kept == 0 && len(dups) > 0 {
+			stats.reject(row, RejectDuplicate, fmt.Sprintf("netMask[%s]", strings.Join(dups, ",")))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	stats.Records = len(recs)
+	return recs, stats, nil
+}
+
+// LoadIPMSRecords : reads filename in format, drops the rows by filters of cfg and maps the office codes to glbIds
+// decisions are the multi-glb decisions of mapping, see ResolveMultiGLB
+func LoadIPMSRecords(format, filename string, cfg *YmlConfig, mapping map[string][]OfficeGLBIDMapping, decisions []*MultiGLBDecision) ([]*IpmsRecord, *SourceStats, error) {
+	filters, err := sourceFilters(format, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	src, err := OpenSource(format, filename, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer src.Close()
+
+	recs, stats, err := ReadIPMSRecords(src, mapping, decisions, filters)
+	if err != nil {
+		return nil, nil, err
+	}
+	stats.log(filename)
+	return recs, stats, nil
+}
+
+// LoadReportCollectorRecords :
+func LoadReportCollectorRecords(format, filename string, cfg *YmlConfig) ([]*IpmsRecord, *SourceStats, error) {
+	filters, err := sourceFilters(format, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	src, err := OpenSource(format, filename, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer src.Close()
+
+	recs, stats, err := ReadReportCollectorRecords(src, filters)
+	if err != nil {
+		return nil, nil, err
+	}
+	stats.log(filename)
+	return recs, stats, nil
+}
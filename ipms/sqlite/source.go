@@ -0,0 +1,86 @@
+// Package sqlite registers the "sqlite" input format, IPMS_DB-share.db of the ipms team
+// it needs cgo, so only the binaries that import it link sqlite3
+package sqlite
+
+import (
+	"database/sql"
+	"io"
+	"strings"
+
+	"github.com/castisdev/ipms-importer/ipms"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const query = "select StartIP, EndIP, AMOC_OFC_CD from IPMSfile_to_AMOC_OFFICE_MAPPING"
+
+func init() {
+	ipms.RegisterSource("sqlite", open)
+	// no netCode and no descriptive fields
+	ipms.RegisterSourceFields("sqlite", func(*ipms.YmlConfig) []string { return []string{ipms.FilterFieldOfficeCode} })
+}
+
+type source struct {
+	db      *sql.DB
+	rows    *sql.Rows
+	line    int
+	cleanup func()
+}
+
+func open(filename string, cfg *ipms.YmlConfig) (ipms.Source, error) {
+	entry := ""
+	if cfg != nil {
+		entry = cfg.InputArchiveEntry
+	}
+	// sqlite3 reads a plain file only, a compressed db is extracted to a temporary file
+	path, cleanup, err := ipms.ExtractInput(filename, entry)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	rows, err := db.Query(query)
+	if err != nil {
+		db.Close()
+		cleanup()
+		return nil, err
+	}
+	return &source{db: db, rows: rows, cleanup: cleanup}, nil
+}
+
+// Next :
+func (src *source) Next() (*ipms.RangeRow, error) {
+	if !src.rows.Next() {
+		if err := src.rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	src.line++
+
+	var s1, s2, s3 sql.NullString
+	if err := src.rows.Scan(&s1, &s2, &s3); err != nil {
+		return nil, err
+	}
+	row := &ipms.RangeRow{
+		Line:       src.line,
+		Raw:        strings.Join([]string{s1.String, s2.String, s3.String}, "|"),
+		StartIP:    s1.String,
+		EndIP:      s2.String,
+		OfficeCode: s3.String,
+	}
+	if !s1.Valid || !s2.Valid || !s3.Valid {
+		row.Invalid = "null column"
+	}
+	return row, nil
+}
+
+// Close :
+func (src *source) Close() error {
+	src.rows.Close()
+	err := src.db.Close()
+	src.cleanup()
+	return err
+}
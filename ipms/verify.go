@@ -0,0 +1,84 @@
+package ipms
+
+import (
+	"fmt"
+	"net"
+	"sort"
+)
+
+// CoverageDiff : addresses of a serviceCode/glbId that merging lost or added
+type CoverageDiff struct {
+	ServiceCode string
+	GLBID       string
+	Lost        []IPRange
+	Added       []IPRange
+}
+
+func (d *CoverageDiff) String() string {
+	return fmt.Sprintf("serviceCode[%s], glbId[%s], lost%v, added%v", d.ServiceCode, d.GLBID, d.Lost, d.Added)
+}
+
+type coverageKey struct {
+	serviceCode string
+	glbID       string
+}
+
+// infoRanges : address ranges of the netMasks per serviceCode and glbId, not merged
+func infoRanges(infos []*ServiceCodeInfo) (map[coverageKey][]IPRange, error) {
+	ranges := map[coverageKey][]IPRange{}
+	for _, sc := range infos {
+		for _, glb := range sc.GLBIDNetMaskList {
+			k := coverageKey{sc.ServiceCode, glb.GLBID}
+			for _, n := range glb.NetMaskAddressList {
+				_, ipnet, err := net.ParseCIDR(n.NetMaskAddress)
+				if err != nil {
+					return nil, err
+				}
+				ip := normalizeIP(ipnet.IP)
+				ranges[k] = append(ranges[k], IPRange{ip, last(ip, ipnet.Mask)})
+			}
+		}
+	}
+	return ranges, nil
+}
+
+// VerifyCoverage : compares the addresses of recs and infos per serviceCode and glbId
+func VerifyCoverage(recs []*IpmsRecord, infos []*ServiceCodeInfo) ([]*CoverageDiff, error) {
+	input := map[coverageKey][]IPRange{}
+	for _, rec := range recs {
+		k := coverageKey{rec.ServiceCode, rec.GLBID}
+		input[k] = append(input[k], rec.Range())
+	}
+
+	merged, err := infoRanges(infos)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := map[coverageKey]struct{}{}
+	for k := range input {
+		keys[k] = struct{}{}
+	}
+	for k := range merged {
+		keys[k] = struct{}{}
+	}
+
+	var diffs []*CoverageDiff
+	for k := range keys {
+		in := mergeRanges(input[k])
+		out := mergeRanges(merged[k])
+		lost := subtractRanges(in, out)
+		added := subtractRanges(out, in)
+		if len(lost) == 0 && len(added) == 0 {
+			continue
+		}
+		diffs = append(diffs, &CoverageDiff{k.serviceCode, k.glbID, lost, added})
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		if diffs[i].ServiceCode != diffs[j].ServiceCode {
+			return diffs[i].ServiceCode < diffs[j].ServiceCode
+		}
+		return diffs[i].GLBID < diffs[j].GLBID
+	})
+	return diffs, nil
+}
@@ -0,0 +1,115 @@
+package ipms
+
+import (
+	"strings"
+	"testing"
+)
+
+// testInfos : netMasks of "serviceCode glbId netCode cidr", in the order of specs
+func testInfos(specs []string) []*ServiceCodeInfo {
+	var infos []*ServiceCodeInfo
+	for _, s := range specs {
+		f := strings.Split(s, " ")
+		var sc *ServiceCodeInfo
+		for _, i := range infos {
+			if i.ServiceCode == f[0] {
+				sc = i
+			}
+		}
+		if sc == nil {
+			sc = &ServiceCodeInfo{ServiceCode: f[0]}
+			infos = append(infos, sc)
+		}
+		var glb *GLBInfo
+		for _, g := range sc.GLBIDNetMaskList {
+			if g.GLBID == f[1] {
+				glb = g
+			}
+		}
+		if glb == nil {
+			glb = &GLBInfo{GLBID: f[1]}
+			sc.GLBIDNetMaskList = append(sc.GLBIDNetMaskList, glb)
+		}
+		glb.NetMaskAddressList = append(glb.NetMaskAddressList, &NetMaskInfo{NetMaskAddress: f[3], NetCode: f[2]})
+	}
+	return infos
+}
+
+func TestVerifyCoverage(t *testing.T) {
+	tests := []struct {
+		name  string
+		recs  []string
+		infos []string
+		want  []string // diffs
+	}{
+		{
+			name:  "same addresses",
+			recs:  []string{"S A 00 10.0.0.0/25", "S A 00 10.0.0.128/25", "S A 00 10.0.0.64/26"},
+			infos: []string{"S A 00 10.0.0.0/24"},
+		},
+		{
+			name:  "lost",
+			recs:  []string{"S A 00 10.0.0.0/24"},
+			infos: []string{"S A 00 10.0.0.0/25"},
+			want:  []string{"serviceCode[S], glbId[A], lost[10.0.0.128-10.0.0.255], added[]"},
+		},
+		{
+			name:  "added",
+			recs:  []string{"S A 00 10.0.0.0/25"},
+			infos: []string{"S A 00 10.0.0.0/24", "S A 00 2001:db8::/32"},
+			want:  []string{"serviceCode[S], glbId[A], lost[], added[10.0.0.128-10.0.0.255 2001:db8::-2001:db8:ffff:ffff:ffff:ffff:ffff:ffff]"},
+		},
+		{
+			name:  "other glbId and serviceCode",
+			recs:  []string{"S A 00 10.0.0.0/24", "T A 00 10.0.1.0/24"},
+			infos: []string{"S B 00 10.0.0.0/24", "T A 00 10.0.1.0/24"},
+			want: []string{
+				"serviceCode[S], glbId[A], lost[10.0.0.0-10.0.0.255], added[]",
+				"serviceCode[S], glbId[B], lost[], added[10.0.0.0-10.0.0.255]",
+			},
+		},
+		{
+			// netCode is not part of the coverage
+			name:  "other netCode",
+			recs:  []string{"S A 00 10.0.0.0/24"},
+			infos: []string{"S A 01 10.0.0.0/24"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diffs, err := VerifyCoverage(testRecords(t, tt.recs), testInfos(tt.infos))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, d := range diffs {
+				got = append(got, d.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("diffs\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+
+	if _, err := VerifyCoverage(nil, testInfos([]string{"S A 00 10.0.0.0"})); err == nil {
+		t.Errorf("invalid netMask, want an error")
+	}
+}
+
+func TestVerifyCoverageOfMerge(t *testing.T) {
+	recs := testRecords(t, []string{
+		"S A 00 10.0.0.0/25", "S A 00 10.0.0.128/25", "S A 00 10.0.0.0/26",
+		"S A 01 10.0.1.0/24", "S B 00 10.0.2.0/24", "S A 00 2001:db8::/33", "S A 00 2001:db8:8000::/33",
+	})
+	infos, err := MergeIPMSRecords(recs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diffs, err := VerifyCoverage(recs, infos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("diffs %v, want none", diffs)
+	}
+}
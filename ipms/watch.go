@@ -0,0 +1,255 @@
+package ipms
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/castisdev/cilog"
+)
+
+// subdirectories of the watch directory that a file is moved to after import
+const (
+	ProcessedDir = "processed"
+	FailedDir    = "failed"
+
+	doneMarkerExt = ".done"
+
+	// the longest wait before a file that failed by a transient error is imported again
+	maxWatchRetryBackoff = time.Hour
+)
+
+// WatchConfig : watch-* settings of the config, durations are parsed
+type WatchConfig struct {
+	Dir        string
+	Pattern    string
+	Interval   time.Duration
+	StableTime time.Duration
+	DoneMarker bool
+}
+
+// WatchConfig : watch-* settings with defaults, error when watch-directory does not exist or a setting is invalid
+func (cfg *YmlConfig) WatchConfig() (*WatchConfig, error) {
+	if cfg.WatchDirectory == "" {
+		return nil, errors.New("watch-directory not exist")
+	}
+	wc := &WatchConfig{Dir: cfg.WatchDirectory, Pattern: cfg.WatchPattern, DoneMarker: cfg.WatchDoneMarker}
+	if wc.Pattern == "" {
+		wc.Pattern = "*"
+	}
+	if _, err := filepath.Match(wc.Pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid watch-pattern, %v", err)
+	}
+	var err error
+	wc.Interval, err = parseDuration(cfg.WatchInterval, 10*time.Second)
+	if err != nil || wc.Interval <= 0 {
+		return nil, fmt.Errorf("invalid watch-interval, %s", cfg.WatchInterval)
+	}
+	wc.StableTime, err = parseDuration(cfg.WatchStableTime, 30*time.Second)
+	if err != nil || wc.StableTime < 0 {
+		return nil, fmt.Errorf("invalid watch-stable-time, %s", cfg.WatchStableTime)
+	}
+	return wc, nil
+}
+
+func parseDuration(s string, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+	return time.ParseDuration(s)
+}
+
+type fileState struct {
+	size    int64
+	modTime time.Time
+	since   time.Time
+}
+
+// retryState : a file kept in the watch directory after a transient failure
+type retryState struct {
+	attempts int
+	next     time.Time
+}
+
+// Watcher : finds the complete files of a watch directory
+// a file is complete when its .done marker exists, or when DoneMarker is false and
+// its size and modification time have not changed for StableTime
+// a file that failed by a transient error is not ready until its retry time
+type Watcher struct {
+	cfg     WatchConfig
+	states  map[string]*fileState
+	retries map[string]*retryState
+	now     func() time.Time
+}
+
+// NewWatcher : creates the watch directory and its processed and failed subdirectories
+func NewWatcher(cfg *WatchConfig) (*Watcher, error) {
+	for _, d := range []string{cfg.Dir, filepath.Join(cfg.Dir, ProcessedDir), filepath.Join(cfg.Dir, FailedDir)} {
+		if err := os.MkdirAll(d, 0777); err != nil {
+			return nil, err
+		}
+	}
+	return &Watcher{cfg: *cfg, states: map[string]*fileState{}, retries: map[string]*retryState{}, now: time.Now}, nil
+}
+
+// Ready : complete files, sorted by name
+func (w *Watcher) Ready() ([]string, error) {
+	fis, err := ioutil.ReadDir(w.cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	now := w.now()
+	names := map[string]os.FileInfo{}
+	for _, fi := range fis {
+		name := fi.Name()
+		if !fi.Mode().IsRegular() || strings.HasPrefix(name, ".") || strings.HasSuffix(name, doneMarkerExt) {
+			continue
+		}
+		if ok, _ := filepath.Match(w.cfg.Pattern, name); !ok {
+			continue
+		}
+		names[name] = fi
+	}
+
+	var ready []string
+	for name, fi := range names {
+		if r, ok := w.retries[name]; ok && now.Before(r.next) {
+			continue
+		}
+		if w.cfg.DoneMarker {
+			if _, err := os.Stat(filepath.Join(w.cfg.Dir, name+doneMarkerExt)); err == nil {
+				ready = append(ready, name)
+			}
+			continue
+		}
+		st, ok := w.states[name]
+		if !ok || st.size != fi.Size() || !st.modTime.Equal(fi.ModTime()) {
+			w.states[name] = &fileState{size: fi.Size(), modTime: fi.ModTime(), since: now}
+			if !ok {
+				cilog.Infof("found %s, size[%d], wait until it is stable", name, fi.Size())
+			}
+			continue
+		}
+		if now.Sub(st.since) >= w.cfg.StableTime {
+			ready = append(ready, name)
+		}
+	}
+	// forget the files that are gone
+	for name := range w.states {
+		if _, ok := names[name]; !ok {
+			delete(w.states, name)
+		}
+	}
+	for name := range w.retries {
+		if _, ok := names[name]; !ok {
+			delete(w.retries, name)
+		}
+	}
+
+	sort.Strings(ready)
+	for i, name := range ready {
+		ready[i] = filepath.Join(w.cfg.Dir, name)
+	}
+	return ready, nil
+}
+
+// Finish : moves the file and its .done marker to processed, or to failed when importErr is not nil
+// returns the moved path
+func (w *Watcher) Finish(filename string, importErr error) (string, error) {
+	dir := ProcessedDir
+	if importErr != nil {
+		dir = FailedDir
+	}
+	name := filepath.Base(filename)
+	delete(w.states, name)
+	delete(w.retries, name)
+
+	dst := filepath.Join(w.cfg.Dir, dir, name)
+	if _, err := os.Stat(dst); err == nil {
+		// do not overwrite a file of an earlier run with the same name
+		dst = fmt.Sprintf("%s.%s", dst, w.now().Format("20060102150405"))
+	}
+	if err := os.Rename(filename, dst); err != nil {
+		return "", err
+	}
+	marker := filename + doneMarkerExt
+	if _, err := os.Stat(marker); err == nil {
+		if err := os.Rename(marker, dst+doneMarkerExt); err != nil {
+			cilog.Warningf("failed to move %s, %v", marker, err)
+		}
+	}
+	return dst, nil
+}
+
+// retryLater : keeps filename in the watch directory until Interval doubled by each attempt, at most an hour
+// returns the wait
+func (w *Watcher) retryLater(filename string) time.Duration {
+	name := filepath.Base(filename)
+	r, ok := w.retries[name]
+	if !ok {
+		r = &retryState{}
+		w.retries[name] = r
+	}
+	r.attempts++
+	d := w.cfg.Interval
+	for i := 1; i < r.attempts && d < maxWatchRetryBackoff; i++ {
+		d *= 2
+	}
+	if d > maxWatchRetryBackoff {
+		d = maxWatchRetryBackoff
+	}
+	r.next = w.now().Add(d)
+	return d
+}
+
+// Run : checks the watch directory every Interval and calls fn for each complete file, one at a time
+// returns when stop is closed, after the file being imported is finished
+func (w *Watcher) Run(stop <-chan struct{}, fn func(filename string) error) {
+	cilog.Infof("watch %s, pattern[%s], interval[%v], stable time[%v], done marker[%v]",
+		w.cfg.Dir, w.cfg.Pattern, w.cfg.Interval, w.cfg.StableTime, w.cfg.DoneMarker)
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		w.runOnce(stop, fn)
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runOnce : calls fn for each complete file, a file is moved to processed when fn succeeds,
+// to failed when fn fails by an InputError, and is kept to retry later when fn fails by another error
+func (w *Watcher) runOnce(stop <-chan struct{}, fn func(filename string) error) {
+	files, err := w.Ready()
+	if err != nil {
+		cilog.Errorf("failed to read watch directory, %v", err)
+	}
+	for _, f := range files {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		err := fn(f)
+		if err != nil && !IsInputError(err) {
+			d := w.retryLater(f)
+			cilog.Warningf("keep %s to import again after %v, attempts[%d], %v", f, d, w.retries[filepath.Base(f)].attempts, err)
+			continue
+		}
+		dst, moveErr := w.Finish(f, err)
+		if moveErr != nil {
+			// the file stays and is imported again
+			cilog.Errorf("failed to move %s, %v", f, moveErr)
+			continue
+		}
+		cilog.Infof("moved %s to %s", f, dst)
+	}
+}
@@ -0,0 +1,200 @@
+package ipms
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestWatcher(t *testing.T, doneMarker bool) (*Watcher, *time.Time) {
+	w, err := NewWatcher(&WatchConfig{
+		Dir:        t.TempDir(),
+		Pattern:    "*.csv",
+		Interval:   10 * time.Second,
+		StableTime: 30 * time.Second,
+		DoneMarker: doneMarker,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 10, 17, 0, 0, 0, 0, time.Local)
+	w.now = func() time.Time { return now }
+	return w, &now
+}
+
+func writeWatchFile(t *testing.T, w *Watcher, name, content string) string {
+	f := filepath.Join(w.cfg.Dir, name)
+	if err := ioutil.WriteFile(f, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func readyNames(t *testing.T, w *Watcher) string {
+	files, err := w.Ready()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, filepath.Base(f))
+	}
+	return strings.Join(names, " ")
+}
+
+func TestWatcherReadyStableTime(t *testing.T) {
+	w, now := newTestWatcher(t, false)
+	writeWatchFile(t, w, "b.csv", "b")
+	writeWatchFile(t, w, "a.csv", "a")
+	writeWatchFile(t, w, "c.txt", "c")
+	writeWatchFile(t, w, ".d.csv", "d")
+
+	if got := readyNames(t, w); got != "" {
+		t.Errorf("ready %s when found, want none", got)
+	}
+	*now = now.Add(29 * time.Second)
+	if got := readyNames(t, w); got != "" {
+		t.Errorf("ready %s before stable time, want none", got)
+	}
+
+	// a growing file waits the stable time again
+	writeWatchFile(t, w, "b.csv", "bb")
+	*now = now.Add(time.Second)
+	if got := readyNames(t, w); got != "a.csv" {
+		t.Errorf("ready %s, want a.csv", got)
+	}
+	*now = now.Add(30 * time.Second)
+	if got := readyNames(t, w); got != "a.csv b.csv" {
+		t.Errorf("ready %s, want a.csv b.csv", got)
+	}
+}
+
+func TestWatcherReadyDoneMarker(t *testing.T) {
+	w, _ := newTestWatcher(t, true)
+	writeWatchFile(t, w, "a.csv", "a")
+	writeWatchFile(t, w, "b.csv", "b")
+	writeWatchFile(t, w, "b.csv"+doneMarkerExt, "")
+
+	if got := readyNames(t, w); got != "b.csv" {
+		t.Errorf("ready %s, want b.csv", got)
+	}
+}
+
+func TestWatcherFinish(t *testing.T) {
+	w, _ := newTestWatcher(t, true)
+	f := writeWatchFile(t, w, "a.csv", "a")
+	writeWatchFile(t, w, "a.csv"+doneMarkerExt, "")
+
+	dst, err := w.Finish(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(w.cfg.Dir, ProcessedDir, "a.csv"); dst != want {
+		t.Errorf("moved to %s, want %s", dst, want)
+	}
+	if _, err := os.Stat(dst + doneMarkerExt); err != nil {
+		t.Errorf("done marker not moved, %v", err)
+	}
+
+	// a file of the same name is not overwritten
+	f = writeWatchFile(t, w, "a.csv", "a2")
+	dst, err = w.Finish(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(w.cfg.Dir, ProcessedDir, "a.csv.20261017000000"); dst != want {
+		t.Errorf("moved to %s, want %s", dst, want)
+	}
+
+	f = writeWatchFile(t, w, "b.csv", "b")
+	dst, err = w.Finish(f, errors.New("failed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(w.cfg.Dir, FailedDir, "b.csv"); dst != want {
+		t.Errorf("moved to %s, want %s", dst, want)
+	}
+}
+
+func TestWatcherRunOnce(t *testing.T) {
+	w, now := newTestWatcher(t, true)
+	for _, name := range []string{"ok.csv", "bad.csv", "down.csv"} {
+		writeWatchFile(t, w, name, name)
+		writeWatchFile(t, w, name+doneMarkerExt, "")
+	}
+	var imported []string
+	down := true
+	fn := func(filename string) error {
+		name := filepath.Base(filename)
+		imported = append(imported, name)
+		switch {
+		case name == "bad.csv":
+			return inputErrorf("failed to get ipms records, invalid line")
+		case name == "down.csv" && down:
+			return errors.New("failed to get mapping info, 503 Service Unavailable")
+		}
+		return nil
+	}
+	stop := make(chan struct{})
+	exists := func(path ...string) bool {
+		_, err := os.Stat(filepath.Join(append([]string{w.cfg.Dir}, path...)...))
+		return err == nil
+	}
+
+	w.runOnce(stop, fn)
+	if got := strings.Join(imported, " "); got != "bad.csv down.csv ok.csv" {
+		t.Errorf("imported %s, want bad.csv down.csv ok.csv", got)
+	}
+	if !exists(ProcessedDir, "ok.csv") || !exists(FailedDir, "bad.csv") {
+		t.Errorf("ok.csv not in %s or bad.csv not in %s", ProcessedDir, FailedDir)
+	}
+	// a transient error keeps the file and its marker to import again
+	if !exists("down.csv") || !exists("down.csv"+doneMarkerExt) || exists(FailedDir, "down.csv") {
+		t.Errorf("down.csv moved, want it kept")
+	}
+
+	// retried after the interval, and then after the doubled interval
+	imported = nil
+	w.runOnce(stop, fn)
+	*now = now.Add(10 * time.Second)
+	w.runOnce(stop, fn)
+	*now = now.Add(10 * time.Second)
+	w.runOnce(stop, fn)
+	if got := strings.Join(imported, " "); got != "down.csv" {
+		t.Errorf("imported %s, want down.csv once", got)
+	}
+	if r := w.retries["down.csv"]; r == nil || r.attempts != 2 || !r.next.Equal(now.Add(10*time.Second)) {
+		t.Errorf("retry %+v, want attempts[2] after 20s", r)
+	}
+
+	down = false
+	*now = now.Add(10 * time.Second)
+	w.runOnce(stop, fn)
+	if !exists(ProcessedDir, "down.csv") || len(w.retries) != 0 {
+		t.Errorf("down.csv not in %s, retries %v", ProcessedDir, w.retries)
+	}
+}
+
+func TestWatcherRetryBackoff(t *testing.T) {
+	w, _ := newTestWatcher(t, true)
+	var got []time.Duration
+	for i := 0; i < 12; i++ {
+		got = append(got, w.retryLater("a.csv"))
+	}
+	if got[0] != 10*time.Second || got[1] != 20*time.Second || got[2] != 40*time.Second || got[11] != maxWatchRetryBackoff {
+		t.Errorf("backoff %v, want 10s 20s 40s ... %v", got, maxWatchRetryBackoff)
+	}
+}
+
+func TestIsInputError(t *testing.T) {
+	if !IsInputError(inputErrorf("failed to get ipms records, %v", errors.New("x"))) {
+		t.Errorf("inputErrorf not an InputError")
+	}
+	if IsInputError(errors.New("failed to post ipms records")) || IsInputError(nil) {
+		t.Errorf("plain error is an InputError")
+	}
+}
@@ -1,36 +1,43 @@
 package main
 
 import (
-	"database/sql"
 	"flag"
 	"fmt"
-	"log"
-	"net"
 	"os"
 	"path"
 
 	"github.com/castisdev/cilog"
 	"github.com/castisdev/ipms-importer/ipms"
+	_ "github.com/castisdev/ipms-importer/ipms/sqlite"
 	"github.com/kardianos/osext"
-	_ "github.com/mattn/go-sqlite3"
 )
 
 const (
 	component   = "sqlite-importer"
 	ymlFilename = "sqlite-importer.yml"
-	ver         = "1.0.2"
+	ver         = "1.1.0"
 	preRelVer   = "-rc.0"
+
+	defaultInputFormat = "sqlite"
 )
 
 func main() {
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [options]... INPUT_FILE\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s [options]... INPUT_FILE...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s [options]... -history | -rollback ID\n", os.Args[0])
 		flag.PrintDefaults()
 	}
 
 	ymlConfigFilePath := flag.String("config-file", "", "config file path")
+	format := flag.String("input-format", "", fmt.Sprintf("input format %v, overrides input-format of config (default %s)", ipms.SourceFormats(), defaultInputFormat))
 	printSimpleVer := flag.Bool("v", false, "print version")
 	printVer := flag.Bool("version", false, "print version includes pre-release version")
+	dryRun := flag.Bool("dry-run", false, "write the post body and summary instead of posting it")
+	dryRunOutput := flag.String("dry-run-output", "-", "file to write the post body of -dry-run, - means stdout")
+	pretty := flag.Bool("pretty", false, "indent the post body of -dry-run")
+	force := flag.Bool("force", false, "import even if the safety thresholds of config are exceeded")
+	listHistory := flag.Bool("history", false, "print the successful imports kept in history-directory of config")
+	rollback := flag.String("rollback", "", "post the import of this history ID again to import-ipms-api, instead of INPUT_FILE")
 	flag.Parse()
 
 	if *printSimpleVer {
@@ -43,15 +50,28 @@ func main() {
 		os.Exit(0)
 	}
 
-	if flag.NArg() < 1 {
+	noInput := *listHistory || *rollback != ""
+	if noInput {
+		if flag.NArg() > 0 || (*listHistory && *rollback != "") {
+			fmt.Fprintf(os.Stderr, "-history and -rollback can not be used with INPUT_FILE or each other\n\n")
+			flag.Usage()
+			os.Exit(1)
+		}
+	} else if flag.NArg() < 1 {
 		fmt.Fprintf(os.Stderr, "there is no INPUT_FILE\n\n")
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	if _, err := os.Stat(flag.Arg(0)); os.IsNotExist(err) {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+	// files, directories or glob patterns
+	var inputs []string
+	if !noInput {
+		var err error
+		inputs, err = ipms.ExpandInputs(flag.Args())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
 	}
 
 	if len(*ymlConfigFilePath) == 0 {
@@ -77,110 +97,45 @@ func main() {
 
 	cilog.Infof("program started")
 
-	mapping, err := ipms.GetOfficeGLBIDMapping(cfg)
-	if err != nil {
-		str := fmt.Sprintf("failed to get mapping info, %v", err)
-		cilog.Errorf(str)
-		fmt.Fprintln(os.Stderr, str)
-		os.Exit(1)
-	}
-
-	ipmsSet, err := getIPMSRecords(flag.Arg(0), mapping)
-	if err != nil {
-		str := fmt.Sprintf("failed to get ipms records, %v", err)
-		cilog.Errorf(str)
-		fmt.Fprintln(os.Stderr, str)
-		os.Exit(1)
-	}
-
-	resultSet, err := ipms.MergeIPMSRecords(ipmsSet)
-	if err != nil {
-		str := fmt.Sprintf("failed to merge ipms records, %v", err)
-		cilog.Errorf(str)
-		fmt.Fprintln(os.Stderr, str)
-		os.Exit(1)
+	if *format == "" {
+		*format = cfg.InputFormat
+	}
+	if *format == "" {
+		*format = defaultInputFormat
+	}
+
+	switch {
+	case *listHistory:
+		err = ipms.PrintIPMSHistory(os.Stdout, cfg)
+	case *rollback != "":
+		err = ipms.RunRollback(cfg, *rollback)
+	default:
+		opt := &ipms.ImportOptions{
+			Format:       *format,
+			DryRun:       *dryRun,
+			DryRunOutput: *dryRunOutput,
+			Pretty:       *pretty,
+			Force:        *force,
+		}
+		err = runImport(cfg, opt, inputs)
 	}
-
-	err = ipms.PostIPMSRecords(cfg, resultSet)
 	if err != nil {
-		str := fmt.Sprintf("failed to post ipms records, %v", err)
+		str := err.Error()
 		cilog.Errorf(str)
 		fmt.Fprintln(os.Stderr, str)
 		os.Exit(1)
 	}
-
-	str := fmt.Sprintf("success to import, %s", flag.Arg(0))
-	cilog.Infof(str)
-	fmt.Println(str)
 	cilog.Infof("program ended")
 }
 
-func getIPMSRecords(filename string, mapping map[string][]ipms.OfficeGLBIDMapping) ([]*ipms.IpmsRecord, error) {
-	var recs []*ipms.IpmsRecord
-
-	db, err := sql.Open("sqlite3", filename)
+// runImport : reads inputs, and then imports, or writes them by -dry-run
+func runImport(cfg *ipms.YmlConfig, opt *ipms.ImportOptions, inputs []string) error {
+	run, err := ipms.LoadImport(cfg, opt.Format, inputs)
 	if err != nil {
-		log.Fatal(err)
-	}
-	defer db.Close()
-
-	rows, err := db.Query("select StartIP, EndIP, AMOC_OFC_CD from IPMSfile_to_AMOC_OFFICE_MAPPING")
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer rows.Close()
-
-	lineCnt := 0
-	invalidLineCnt := 0
-	failedOfficeCodes := map[string]int{}
-	for rows.Next() {
-		lineCnt++
-
-		var s1, s2, s3 sql.NullString
-		err = rows.Scan(&s1, &s2, &s3)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		if s1.Valid == false || s2.Valid == false || s3.Valid == false {
-			cilog.Warningf("invalid row[%d]", lineCnt)
-			invalidLineCnt++
-			continue
-		}
-
-		officeCode := s3.String
-		if glbs, ok := mapping[officeCode]; ok {
-			for _, glb := range glbs {
-				ips := net.ParseIP(s1.String)
-				ipe := net.ParseIP(s2.String)
-				if ips == nil || ipe == nil {
-					cilog.Warningf("invalid row[%d], %s, %s", lineCnt, s1.String, s2.String)
-					invalidLineCnt++
-					continue
-				}
-				cidrs := ipms.Range2CIDRs(ips, ipe)
-				for _, cidr := range cidrs {
-					rec, err := ipms.NewRecordFromCIDR(glb.ServiceCode, glb.GLBID, "", officeCode, cidr)
-					if err != nil {
-						return nil, err
-					}
-					recs = append(recs, rec)
-				}
-			}
-		} else {
-			failedOfficeCodes[officeCode] = lineCnt
-			invalidLineCnt++
-		}
+		return err
 	}
-
-	if err := rows.Err(); err != nil {
-		return nil, err
+	if err := run.ResolveRecords(cfg); err != nil {
+		return err
 	}
-
-	for k, v := range failedOfficeCodes {
-		cilog.Warningf("invalid office code, %s, row[%d]", k, v)
-	}
-	cilog.Infof("success to read sqlite db, rows[%d], invalid rows[%d], records[%d]", lineCnt, invalidLineCnt, len(recs))
-
-	return recs, nil
+	return ipms.RunImport(cfg, opt, run)
 }